@@ -0,0 +1,50 @@
+package yield
+
+import (
+	core "github.com/acsellers/yield"
+	"github.com/revel/revel"
+	"github.com/revel/revel/cache"
+	htmlTmpl "html/template"
+	"time"
+)
+
+/*
+A core.FragmentCache kept in revel's cache, so cached_yield fragments can be
+shared between app servers through memcached or redis. To use it, configure
+revel's cache and set it as the cache in your app's init:
+
+	core.Cache = yield.RevelFragmentCache{}
+*/
+type RevelFragmentCache struct{}
+
+func (RevelFragmentCache) Get(key string) (htmlTmpl.HTML, bool) {
+	var html string
+	if err := cache.Get(key, &html); err != nil {
+		if err != cache.ErrCacheMiss {
+			revel.AppLog.Error("Failed to get fragment from the cache", "key", key, "error", err)
+		}
+		return "", false
+	}
+	return htmlTmpl.HTML(html), true
+}
+
+func (RevelFragmentCache) Set(key string, html htmlTmpl.HTML, ttl time.Duration) {
+	if ttl == 0 {
+		ttl = cache.ForEverNeverExpiry
+	}
+	if err := cache.Set(key, string(html), ttl); err != nil {
+		revel.AppLog.Error("Failed to add fragment to the cache", "key", key, "error", err)
+	}
+}
+
+func (RevelFragmentCache) Delete(key string) {
+	if err := cache.Delete(key); err != nil && err != cache.ErrCacheMiss {
+		revel.AppLog.Error("Failed to delete fragment from the cache", "key", key, "error", err)
+	}
+}
+
+// Remove a cached_yield fragment from the cache, i.e. after changing what a
+// cached sidebar shows, see core.ExpireFragment.
+func (lc *Controller) ExpireFragment(yieldName string, key interface{}) {
+	core.ExpireFragment(yieldName, key)
+}
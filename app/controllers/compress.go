@@ -0,0 +1,62 @@
+package yield
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/revel/revel"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// The Content-Encodings a laid out response can be compressed with, in order
+// of preference.
+var encodings = []string{"gzip", "deflate"}
+
+type compressWriter interface {
+	io.WriteCloser
+	Flush() error
+}
+
+// The deflate Content-Encoding is deflate data in the zlib format, not bare.
+func newCompressor(w io.Writer, encoding string) compressWriter {
+	if encoding == "gzip" {
+		return gzip.NewWriter(w)
+	}
+	return zlib.NewWriter(w)
+}
+
+/*
+The encoding to compress the response with, or empty when results.compress is
+off, or the request doesn't accept either encoding. As the response depends
+on Accept-Encoding whenever compression is on, Vary is set for caches.
+*/
+func negotiateEncoding(req *revel.Request, resp *revel.Response) string {
+	if !revel.Config.BoolDefault("results.compress", false) ||
+		revel.Config.BoolDefault("results.compressed", false) {
+		return ""
+	}
+	resp.Out.Header().Add("Vary", "Accept-Encoding")
+
+	// Whether each listed encoding is accepted, those not listed are accepted
+	// when * is.
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(req.GetHttpHeader("Accept-Encoding"), ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		accepted[name] = true
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(param[2:], 64)
+				accepted[name] = err == nil && q > 0
+			}
+		}
+	}
+	for _, encoding := range encodings {
+		if ok, listed := accepted[encoding]; ok || (!listed && accepted["*"]) {
+			return encoding
+		}
+	}
+	return ""
+}
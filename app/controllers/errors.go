@@ -0,0 +1,120 @@
+package yield
+
+import (
+	"fmt"
+	core "github.com/acsellers/yield"
+	"github.com/revel/revel"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+)
+
+/*
+In prod mode, error pages are rendered inside the DefaultLayout for the request
+format, so they keep the chrome of the rest of your site. The error template is
+picked the same way revel does, i.e. "errors/404.html", unless ErrorTemplates
+has a template for the status code and format, i.e. ErrorTemplates["404.html"] =
+"errors/not_found.html". The template gets the error as .Error, like revel's.
+
+If the error template or the layout fails to render, which is likely when it is
+the layout that caused the error, revel's plain error page is used instead. In
+dev mode revel's error page is always used, as it shows the error's source.
+*/
+var ErrorTemplates = make(map[string]string)
+
+/*
+The Result returned by Controller.RenderError and Controller.NotFound, and used
+by RenderLayoutTemplateResult when rendering fails. It renders the error page
+inside a layout as described for ErrorTemplates, falling back to revel's
+ErrorResult. The response status is used as the status of the error page, 500
+if it has not been set.
+*/
+type LayoutErrorResult struct {
+	ViewArgs map[string]interface{}
+	Error    error
+}
+
+func (r LayoutErrorResult) Apply(req *revel.Request, resp *revel.Response) {
+	if revel.DevMode || !r.applyLayout(req, resp) {
+		revel.ErrorResult{ViewArgs: r.ViewArgs, Error: r.Error}.Apply(req, resp)
+	}
+}
+
+// Render the error page inside the layout. Nothing is written to the response
+// unless rendering succeeds, returns whether it did.
+func (r LayoutErrorResult) applyLayout(req *revel.Request, resp *revel.Response) bool {
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusInternalServerError
+	}
+	format := req.Format
+	templatePath, found := ErrorTemplates[fmt.Sprintf("%d.%s", status, format)]
+	if !found {
+		templatePath = fmt.Sprintf("errors/%d.%s", status, format)
+	}
+
+	tmpl, err := findView(templatePath)
+	if err != nil {
+		return false
+	}
+	var layouts []core.Template
+	if layout := DefaultLayout[format]; layout != "" {
+		layouts, err = core.LayoutChain(layout, ParentLayout, func(name string) (core.Template, error) {
+			return findLayout(name, format)
+		})
+		if err != nil {
+			return false
+		}
+	}
+
+	// Render with a fresh ContentStore, so nothing the failed render added
+	// ends up on the error page.
+	args := make(map[string]interface{}, len(r.ViewArgs)+2)
+	for key, value := range r.ViewArgs {
+		args[key] = value
+	}
+	args[core.ContentKey] = &core.ContentStore{Lookup: lookupView, Format: format}
+	args["DevMode"] = revel.DevMode
+	if revelError, ok := r.Error.(*revel.Error); ok {
+		args["Error"] = revelError
+	} else {
+		args["Error"] = &revel.Error{Title: "Server Error", Description: r.Error.Error()}
+	}
+
+	b := core.GetBuffer()
+	defer core.PutBuffer(b)
+	err = core.Execute(b, tmpl, layouts, args)
+	if err != nil {
+		revel.AppLog.Error("Failed to render laid out error page", "template", templatePath, "error", err)
+		return false
+	}
+
+	out := resp.GetWriter()
+	if req.Method == "HEAD" {
+		out = ioutil.Discard
+	}
+	resp.Status = status
+	resp.Out.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+	resp.WriteHeader(status, core.ContentType("."+format))
+	b.WriteTo(out)
+	return true
+}
+
+// The same as revel's RenderError, but the error page is laid out in prod
+// mode, see ErrorTemplates.
+func (lc *Controller) RenderError(err error) revel.Result {
+	if lc.Response.Status == 0 {
+		lc.Response.Status = http.StatusInternalServerError
+	}
+	return LayoutErrorResult{ViewArgs: lc.ViewArgs, Error: err}
+}
+
+// The same as revel's NotFound, but the error page is laid out in prod mode,
+// see ErrorTemplates.
+func (lc *Controller) NotFound(msg string, objs ...interface{}) revel.Result {
+	if len(objs) > 0 {
+		msg = fmt.Sprintf(msg, objs...)
+	}
+	lc.Response.Status = http.StatusNotFound
+	return lc.RenderError(&revel.Error{Title: "Not Found", Description: msg})
+}
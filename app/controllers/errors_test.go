@@ -0,0 +1,81 @@
+package yield
+
+import (
+	"errors"
+	"github.com/revel/revel"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLayoutErrorResult(t *testing.T) {
+	cases := []struct {
+		name          string
+		layout        string
+		errorTemplate string
+		err           error
+		expected      string
+	}{
+		{"laid out", `<main>{{yield .}}</main>`, "", &revel.Error{Title: "Not Found", Description: "No hotel 5"},
+			"<main><h1>No hotel 5</h1></main>"},
+		{"error template", `<main>{{yield .}}</main>`, "errors/not_found.html", &revel.Error{Description: "No hotel 5"},
+			"<main><p>Missing: No hotel 5</p></main>"},
+		{"plain error", `<main>{{yield .}}</main>`, "", errors.New("No hotel 5"),
+			"<main><h1>No hotel 5</h1></main>"},
+		// Left to revel's error page, as the layout fails as well.
+		{"broken layout", `<main>{{.missing.Name}}{{yield .}}</main>`, "", &revel.Error{Description: "No hotel 5"}, ""},
+		{"missing error template", `<main>{{yield .}}</main>`, "errors/gone.html", &revel.Error{Description: "No hotel 5"}, ""},
+	}
+	for _, c := range cases {
+		setupTemplates(t, map[string]string{
+			"errors/404.html":       `<h1>{{.Error.Description}}</h1>`,
+			"errors/not_found.html": `<p>Missing: {{.Error.Description}}</p>`,
+		}, map[string]string{
+			"application.html": c.layout,
+		})
+		setLayoutNames(t, map[string]string{"html": "application"}, map[string]string{})
+		revel.DevMode = false
+		if c.errorTemplate != "" {
+			ErrorTemplates["404.html"] = c.errorTemplate
+		}
+
+		lc, w := hotelsController("html")
+		lc.ViewArgs["missing"] = nil
+		lc.Response.Status = 404
+		// Apply falls back to revel's error page when applyLayout fails, which
+		// needs the app's config to be loaded.
+		applied := lc.RenderError(c.err).(LayoutErrorResult).applyLayout(lc.Request, lc.Response)
+		delete(ErrorTemplates, "404.html")
+
+		if applied != (c.expected != "") {
+			t.Errorf("%s: Expected the layout to be applied %v", c.name, c.expected != "")
+		}
+		if !applied {
+			if w.Body.Len() > 0 || w.Header().Get("Content-Type") != "" {
+				t.Errorf("%s: Expected nothing written, got %q", c.name, w.Body.String())
+			}
+			continue
+		}
+		if w.Code != 404 || w.Body.String() != c.expected {
+			t.Errorf("%s: Expected 404 %q, got %d %q", c.name, c.expected, w.Code, w.Body.String())
+		}
+	}
+}
+
+// Errors while rendering a laid out view are shown in the layout, with a 500.
+func TestRenderErrorLaidOut(t *testing.T) {
+	setupTemplates(t, map[string]string{
+		"errors/500.html": `<h1>Sorry</h1>`,
+	}, map[string]string{
+		"application.html": `<main>{{yield .}}</main>`,
+	})
+	setLayoutNames(t, map[string]string{"html": "application"}, map[string]string{})
+	setConfig(t, nil)
+	revel.DevMode = false
+
+	c, w := testController(httptest.NewRequest("GET", "/", nil), "html")
+	r := layoutResult("hotel {{.missing.Name}}")
+	r.Apply(c.Request, c.Response)
+	if w.Code != 500 || w.Body.String() != "<main><h1>Sorry</h1></main>" {
+		t.Errorf("Expected the laid out error page, got %d %q", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,75 @@
+package yield
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestIsPartialRequest(t *testing.T) {
+	cases := []struct {
+		format  string
+		header  string
+		value   string
+		partial bool
+	}{
+		{"html", "", "", false},
+		{"html", "X-Requested-With", "XMLHttpRequest", true},
+		{"html", "X-PJAX", "true", true},
+		{"html", "Turbo-Frame", "sidebar", true},
+		{"json", "X-Requested-With", "XMLHttpRequest", false},
+		{"xml", "Turbo-Frame", "sidebar", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/hotels", nil)
+		if c.header != "" {
+			r.Header.Set(c.header, c.value)
+		}
+		controller, _ := testController(r, c.format)
+		if partial := (&Controller{Controller: controller}).isPartialRequest(); partial != c.partial {
+			t.Errorf("%s request with %s: %q was partial %v, expected %v",
+				c.format, c.header, c.value, partial, c.partial)
+		}
+	}
+}
+
+func TestPartialRequestRendering(t *testing.T) {
+	setupTemplates(t, map[string]string{
+		"Hotels/Show.html": `{{content_for "title" "Ritz & Co" .}}{{content_for "sidebar" "<p>Near</p>" .}}<h1>Ritz</h1>`,
+	}, map[string]string{
+		"application.html": `<title>{{yield "title" .}}</title><main>{{yield .}}</main>`,
+	})
+	setLayoutNames(t, map[string]string{"html": "application"}, map[string]string{})
+	setConfig(t, nil)
+
+	cases := []struct {
+		name, header, value, body, title string
+	}{
+		{"full page", "", "", "<title>Ritz &amp; Co</title><main><h1>Ritz</h1></main>", ""},
+		{"pjax", "X-PJAX", "true", "<h1>Ritz</h1>", "Ritz%20&amp%3B%20Co"},
+		{"region", "Turbo-Frame", "sidebar", "&lt;p&gt;Near&lt;/p&gt;", "Ritz%20&amp%3B%20Co"},
+		{"region with a hash", "X-PJAX-Container", "#sidebar", "&lt;p&gt;Near&lt;/p&gt;", "Ritz%20&amp%3B%20Co"},
+		{"unknown region", "Turbo-Frame", "footer", "<h1>Ritz</h1>", "Ritz%20&amp%3B%20Co"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/hotels/1", nil)
+		if c.header != "" {
+			r.Header.Set(c.header, c.value)
+		}
+		if c.header == "X-PJAX-Container" {
+			r.Header.Set("X-PJAX", "true")
+		}
+		lc, w := hotelsControllerFor(r, "html")
+		lc.renderAction().Apply(lc.Request, lc.Response)
+
+		if w.Body.String() != c.body {
+			t.Errorf("%s: Expected %q, got %q", c.name, c.body, w.Body.String())
+		}
+		if title := w.Header().Get("X-Page-Title"); title != c.title {
+			t.Errorf("%s: Expected X-Page-Title %q, got %q", c.name, c.title, title)
+		}
+		if vary := w.Header().Get("Vary"); !strings.Contains(vary, "Turbo-Frame") {
+			t.Errorf("%s: Expected Vary on the partial headers, got %q", c.name, vary)
+		}
+	}
+}
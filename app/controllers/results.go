@@ -1,30 +1,71 @@
 package yield
 
 import (
-	"bytes"
+	"crypto/sha1"
+	"errors"
 	"fmt"
-	"github.com/robfig/revel"
+	core "github.com/acsellers/yield"
+	"github.com/revel/revel"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 /*
 This is the Result object passed to revel when you render
-a view with a Layout set. RenderTmpl is the Templates that
-were set with ContentFor. Layout is the set Layout. Otherwise
+a view with a Layout set. Content is what was registered
+for the named yields with ContentFor. Layout is the set Layout, and Parents
+are the layouts it is nested within, from the innermost outwards. Otherwise
 it is the same as revel's RenderTemplateResult. This actually
 doesn't require a Layout to be set, not that its used with that
 functionality.
+
+Status is sent as the status code of the response, 200 if it is zero.
+Errors while rendering are always sent with a 500 status instead.
+
+ContentType is sent as the Content-Type of the response. When it is empty,
+the Content-Type set on the Response is used, and failing that one is picked
+from the extension of the Template, see core.ContentType.
+
+Setting results.stream = true in app.conf streams the response, sending the
+head of the layout before the view is rendered, see core.Stream. Setting
+results.yields.concurrency to a number above zero renders the named yields
+concurrently, that many at a time, before the layout, see
+core.ContentStore.Prepare.
+
+Setting results.compress = true compresses responses with gzip or deflate,
+when the request's Accept-Encoding allows it. Buffered responses are only
+compressed when they are at least results.compress.min_size bytes, 1024 by
+default, chunked and streamed responses always are. It is not used when
+revel's own results.compressed is on, as that already compresses everything.
+
+Partial is set for requests that swap part of a page, see PartialHeaders.
+The named yields in FragmentHeaders are sent as headers, and if Region names
+a yield with content, only that is sent rather than the whole view. Partial
+responses are always buffered, so the headers can be set after rendering.
+
+Setting results.etag = true sends an ETag of the rendered body, and answers
+requests with a matching If-None-Match with 304 Not Modified. LastModified,
+when set, is sent as Last-Modified and checked against If-Modified-Since. Both
+only apply when the response is buffered, not when it is chunked or streamed.
 */
 type RenderLayoutTemplateResult struct {
-	Template   revel.Template
-	Layout     revel.Template
-	RenderArgs map[string]interface{}
-	RenderTmpl map[string]revel.Template
+	Template     revel.Template
+	Layout       core.Template
+	Parents      []core.Template
+	ViewArgs     map[string]interface{}
+	Content      *core.ContentStore
+	ContentType  string
+	Status       int
+	LastModified time.Time
+	Partial      bool
+	Region       string
 }
 
 // Render the Templates into the Response, handles errors and panics using the
@@ -33,32 +74,50 @@ func (r *RenderLayoutTemplateResult) Apply(req *revel.Request, resp *revel.Respo
 	// Handle panics when rendering templates.
 	defer func() {
 		if err := recover(); err != nil {
-			revel.ERROR.Println(err)
-			revel.PlaintextErrorResult{fmt.Errorf("Template Execution Panic in %s:\n%s",
+			revel.AppLog.Error("Template Execution Panic", "template", r.Template.Name(), "error", err)
+			resp.Status = http.StatusInternalServerError
+			LayoutErrorResult{ViewArgs: r.ViewArgs, Error: fmt.Errorf("Template Execution Panic in %s:\n%s",
 				r.Template.Name(), err)}.Apply(req, resp)
 		}
 	}()
 
-	chunked := revel.Config.BoolDefault("results.chunked", false)
-	r.RenderTmpl[""] = r.Template
-	r.RenderArgs["ContentForItems"] = r.RenderTmpl
+	chunked := revel.Config.BoolDefault("results.chunked", false) && !r.Partial
+	stream := revel.Config.BoolDefault("results.stream", false) && !r.Partial
+	if r.Content == nil {
+		r.Content = &core.ContentStore{}
+	}
+	r.Content.Lookup = lookupViewFrom(r.Template)
+	if r.Content.Concurrency == 0 {
+		r.Content.Concurrency = revel.Config.IntDefault("results.yields.concurrency", 0)
+	}
+	r.ViewArgs[core.ContentKey] = r.Content
+	if r.ContentType != "" {
+		resp.ContentType = r.ContentType
+	}
+	if r.Status != 0 {
+		resp.Status = r.Status
+	}
 
 	// If it's a HEAD request, throw away the bytes.
-	out := io.Writer(resp.Out)
+	out := resp.GetWriter()
 	if req.Method == "HEAD" {
 		out = ioutil.Discard
 	}
+	encoding := negotiateEncoding(req, resp)
+
+	// Streaming starts the layout straight away, flushing everything before its
+	// main yield before the view renders, see core.Stream. Like chunked in prod
+	// mode, an error can only be reported after part of the page has been sent.
+	if stream {
+		r.renderThrough(req, resp, out, encoding, core.Stream)
+		return
+	}
 
 	// In a prod mode, write the status, render, and hope for the best.
 	// (In a dev mode, always render to a temporary buffer first to avoid having
 	// error pages distorted by HTML already written)
 	if chunked && !revel.DevMode {
-		resp.WriteHeader(http.StatusOK, "text/html")
-		if r.Layout == nil {
-			r.render(req, resp, out)
-		} else {
-			r.renderWithLayout(req, resp, out)
-		}
+		r.renderThrough(req, resp, out, encoding, core.Execute)
 		return
 	}
 
@@ -66,75 +125,293 @@ func (r *RenderLayoutTemplateResult) Apply(req *revel.Request, resp *revel.Respo
 	// rendering the template.  If not, then copy it into the response buffer.
 	// Otherwise, template render errors may result in unpredictable HTML (and
 	// would carry a 200 status code)
-	var b bytes.Buffer
-	if r.Layout == nil {
-		r.render(req, resp, &b)
-	} else {
-		r.renderWithLayout(req, resp, &b)
+	b := core.GetBuffer()
+	defer core.PutBuffer(b)
+	if !r.render(req, resp, b) {
+		return
+	}
+	if b.Len() < revel.Config.IntDefault("results.compress.min_size", 1024) {
+		encoding = ""
+	}
+	if r.notModified(req, resp, b.Bytes(), encoding) {
+		return
+	}
+	if encoding != "" {
+		compressed := core.GetBuffer()
+		defer core.PutBuffer(compressed)
+		compressor := newCompressor(compressed, encoding)
+		b.WriteTo(compressor)
+		compressor.Close()
+		resp.Out.Header().Set("Content-Encoding", encoding)
+		b = compressed
 	}
 
 	if !chunked {
 		resp.Out.Header().Set("Content-Length", strconv.Itoa(b.Len()))
 	}
-	resp.WriteHeader(http.StatusOK, "text/html")
+	resp.WriteHeader(http.StatusOK, r.contentType(req))
 	b.WriteTo(out)
 }
 
-func (r *RenderLayoutTemplateResult) render(req *revel.Request, resp *revel.Response, wr io.Writer) {
-	err := r.Template.Render(wr, r.RenderArgs)
-	if err == nil {
+/*
+Set the ETag and Last-Modified headers of the response when they are enabled,
+and respond with 304 Not Modified, returning true, when the request's
+If-None-Match or If-Modified-Since headers show the client has the body
+already. If-Modified-Since is ignored when If-None-Match is sent. The ETag
+is of the uncompressed body, with the encoding the body will be sent with
+added, so each encoding of the body has its own.
+*/
+func (r *RenderLayoutTemplateResult) notModified(req *revel.Request, resp *revel.Response, body []byte, encoding string) bool {
+	header := resp.Out.Header()
+	matched := false
+	if revel.Config.BoolDefault("results.etag", false) {
+		etag := fmt.Sprintf(`"%x"`, sha1.Sum(body))
+		if encoding != "" {
+			etag = fmt.Sprintf(`"%x-%s"`, sha1.Sum(body), encoding)
+		}
+		header.Set("ETag", etag)
+		matched = etagMatches(req.GetHttpHeader("If-None-Match"), etag)
+	}
+	if !r.LastModified.IsZero() {
+		modified := r.LastModified.UTC().Truncate(time.Second)
+		header.Set("Last-Modified", modified.Format(http.TimeFormat))
+		if req.GetHttpHeader("If-None-Match") == "" {
+			since, err := http.ParseTime(req.GetHttpHeader("If-Modified-Since"))
+			matched = err == nil && !modified.After(since)
+		}
+	}
+
+	if !matched || (req.Method != "GET" && req.Method != "HEAD") ||
+		(resp.Status != 0 && resp.Status != http.StatusOK) {
+		return false
+	}
+	resp.Status = http.StatusNotModified
+	resp.WriteHeader(http.StatusNotModified, r.contentType(req))
+	return true
+}
+
+// Whether an If-None-Match header lists the ETag, or is "*".
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// The content type to respond with, when the Response does not have one.
+func (r *RenderLayoutTemplateResult) contentType(req *revel.Request) string {
+	if path.Ext(r.Template.Name()) == "" {
+		return core.ContentType("." + req.Format)
+	}
+	return core.ContentType(r.Template.Name())
+}
+
+/*
+Render straight into the response with execute, either core.Execute or
+core.Stream, compressing it with the encoding unless it is empty. When
+streaming, the Flush hook of the Content flushes the compressor and the
+response.
+*/
+func (r *RenderLayoutTemplateResult) renderThrough(req *revel.Request, resp *revel.Response, out io.Writer,
+	encoding string, execute func(io.Writer, core.Template, []core.Template, map[string]interface{}) error) {
+	var compressor compressWriter
+	wr := out
+	if encoding != "" {
+		compressor = newCompressor(out, encoding)
+		resp.Out.Header().Set("Content-Encoding", encoding)
+		wr = compressor
+	}
+	if flusher, ok := out.(http.Flusher); ok {
+		r.Content.Flush = func() {
+			if compressor != nil {
+				compressor.Flush()
+			}
+			flusher.Flush()
+		}
+	}
+
+	resp.WriteHeader(http.StatusOK, r.contentType(req))
+	err := execute(wr, r.Template, r.layouts(), r.ViewArgs)
+	if compressor != nil {
+		compressor.Close()
+		if err != nil {
+			// An error page written after the end of the compressed body
+			// would corrupt it, so the page is left cut short.
+			r.templateError(err)
+		}
 		return
 	}
-	r.renderError(req, resp, err)
+	if err != nil {
+		r.renderError(req, resp, err)
+	}
 }
 
-func (r *RenderLayoutTemplateResult) renderWithLayout(req *revel.Request, resp *revel.Response, wr io.Writer) {
-	err := r.Layout.Render(wr, r.RenderArgs)
+// Renders the Template inside the Layout and its Parents, see core.Execute.
+// When rendering fails the error page is applied, and false returned.
+func (r *RenderLayoutTemplateResult) render(req *revel.Request, resp *revel.Response, wr io.Writer) bool {
+	var err error
+	if r.Partial {
+		err = r.renderPartial(resp, wr)
+	} else {
+		err = core.Execute(wr, r.Template, r.layouts(), r.ViewArgs)
+	}
 	if err == nil {
-		return
+		return true
 	}
 	r.renderError(req, resp, err)
+	return false
+}
+
+// Render the Template, sending only its Region when it has one, and set the
+// FragmentHeaders from its named yields.
+func (r *RenderLayoutTemplateResult) renderPartial(resp *revel.Response, wr io.Writer) error {
+	b := core.GetBuffer()
+	defer core.PutBuffer(b)
+	err := core.Execute(b, r.Template, r.layouts(), r.ViewArgs)
+	if err != nil {
+		return err
+	}
+
+	header := resp.Out.Header()
+	for name, key := range FragmentHeaders {
+		if !r.Content.Has(name) {
+			continue
+		}
+		html, err := r.Content.Render(name, r.ViewArgs)
+		if err != nil {
+			return err
+		}
+		header.Set(key, url.PathEscape(strings.TrimSpace(string(html))))
+	}
+
+	if r.Region != "" && r.Content.Has(r.Region) {
+		html, err := r.Content.Render(r.Region, r.ViewArgs)
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(wr, string(html))
+		return err
+	}
+	_, err = b.WriteTo(wr)
+	return err
+}
+
+// The Layout and its Parents, from the innermost outwards.
+func (r *RenderLayoutTemplateResult) layouts() []core.Template {
+	if r.Layout == nil {
+		return nil
+	}
+	return append([]core.Template{r.Layout}, r.Parents...)
 }
 
+// Report a failed render with the error page, see templateError.
 func (r *RenderLayoutTemplateResult) renderError(req *revel.Request, resp *revel.Response, err error) {
-	var templateContent []string
-	templateName, line, description := parseTemplateError(err)
-	if templateName == "" {
-		templateName = r.Layout.Name()
-		templateContent = r.Layout.Content()
+	resp.Status = 500
+	LayoutErrorResult{ViewArgs: r.ViewArgs, Error: r.templateError(err)}.Apply(req, resp)
+}
+
+/*
+Log a failed render, and return it as a revel.Error for the error page. The
+error is attributed to the innermost template of its render stack, so an error
+in a partial rendered within a named yield shows the partial's source rather
+than the layout's, with the stack added to the description.
+*/
+func (r *RenderLayoutTemplateResult) templateError(err error) *revel.Error {
+	var failed, trace, templateName, description string
+	var line, column int
+	var renderErr *core.RenderError
+	if errors.As(err, &renderErr) {
+		failed = renderErr.Template()
+		if len(renderErr.Stack) > 1 {
+			trace = renderErr.Trace()
+		}
+		templateName, line, column = renderErr.Name, renderErr.Line, renderErr.Column
+		description = renderErr.Description
+		if context := renderErr.Context; context != "" {
+			if !strings.HasPrefix(context, "{{") {
+				context = "{{" + context + "}}"
+			}
+			description = fmt.Sprintf("%s at %s", description, context)
+		}
 	} else {
-		if tmpl, err := revel.MainTemplateLoader.Template(templateName); err == nil {
-			templateContent = tmpl.Content()
+		templateName, line, description = parseTemplateError(err)
+	}
+
+	templateContent := sourceOf(templateName)
+	if templateContent == nil && failed != "" {
+		// The error names a {{define}} block, or nothing, so use the file it
+		// was in, which the line numbers refer to as well.
+		templateName = failed
+		templateContent = sourceOf(failed)
+	}
+	if templateName == "" {
+		outer := core.Template(r.Template)
+		if layouts := r.layouts(); len(layouts) > 0 {
+			outer = layouts[len(layouts)-1]
 		}
+		templateName = outer.Name()
+		templateContent = templateSource(outer)
+	}
+	if trace != "" {
+		description = fmt.Sprintf("%s (rendering %s)", description, trace)
 	}
 	compileError := &revel.Error{
 		Title:       "Layout Execution Error",
 		Path:        templateName,
 		Description: description,
 		Line:        line,
+		Column:      column,
 		SourceLines: templateContent,
 	}
-	resp.Status = 500
-	revel.ERROR.Printf("Template Execution Error (in %s): %s", templateName, description)
-	revel.ErrorResult{r.RenderArgs, compileError}.Apply(req, resp)
+	revel.AppLog.Errorf("Template Execution Error (in %s): %s", templateName, description)
+	return compileError
+}
+
+// The source lines of a view or layout, nil if there is no such template.
+func sourceOf(name string) []string {
+	if name == "" {
+		return nil
+	}
+	if tmpl, err := revel.MainTemplateLoader.Template(name); err == nil {
+		return tmpl.Content()
+	}
+	if tmpl, err := layouts().Template(name); err == nil {
+		return templateSource(tmpl)
+	}
+	return nil
+}
+
+// The source lines of a template, when it knows them.
+func templateSource(tmpl core.Template) []string {
+	if source, ok := tmpl.(interface {
+		Content() []string
+	}); ok {
+		return source.Content()
+	}
+	return nil
 }
 
 // Parse the line, and description from an error message like:
 // html/template:Application/Register.html:36: no such template "footer.html"
+// The column after the line, when there is one, is dropped. This is only used
+// for errors that aren't a core.RenderError, which has already parsed them.
 func parseTemplateError(err error) (templateName string, line int, description string) {
 	description = err.Error()
-	i := regexp.MustCompile(`:\d+:`).FindStringIndex(description)
+	i := regexp.MustCompile(`:(\d+)(?::\d+)?:`).FindStringSubmatchIndex(description)
 	if i != nil {
-		line, err = strconv.Atoi(description[i[0]+1 : i[1]-1])
+		line, err = strconv.Atoi(description[i[2]:i[3]])
 		if err != nil {
-			revel.ERROR.Println("Failed to parse line number from error message:", err)
+			revel.AppLog.Error("Failed to parse line number from error message", "error", err)
 		}
 		templateName = description[:i[0]]
 		if colon := strings.Index(templateName, ":"); colon != -1 {
 			templateName = templateName[colon+1:]
 		}
 		templateName = strings.TrimSpace(templateName)
-		description = description[i[1]+1:]
+		description = strings.TrimSpace(description[i[1]:])
 	}
 	return templateName, line, description
 }
@@ -0,0 +1,308 @@
+package yield
+
+import (
+	"compress/gzip"
+	"errors"
+	core "github.com/acsellers/yield"
+	"github.com/revel/revel"
+	htmlTmpl "html/template"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// A revel.Template over html/template with the yield functions.
+type viewTemplate struct {
+	*htmlTmpl.Template
+}
+
+func parseView(name, text string) viewTemplate {
+	tmpl := htmlTmpl.New(name).Funcs(core.Funcs)
+	return viewTemplate{htmlTmpl.Must(tmpl.Parse(text))}
+}
+
+func (v viewTemplate) Content() []string {
+	return strings.Split(v.Tree.Root.String(), "\n")
+}
+
+func (v viewTemplate) Location() string {
+	return v.Name()
+}
+
+func (v viewTemplate) Render(wr io.Writer, arg interface{}) error {
+	return v.Execute(wr, arg)
+}
+
+var registerEngines sync.Once
+
+// Give revel a view loader over a fresh directory holding the views, and the
+// layout loader one holding the layouts.
+func setupTemplates(t *testing.T, views, layouts map[string]string) {
+	setupLayouts(t, layouts)
+	// revel registers its template engines as it loads modules.
+	registerEngines.Do(func() {
+		revel.RaiseEvent(revel.REVEL_BEFORE_MODULES_LOADED, nil)
+	})
+	dir := t.TempDir()
+	for name, content := range views {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+	oldLoader := revel.MainTemplateLoader
+	revel.MainTemplateLoader = revel.NewTemplateLoader([]string{dir})
+	if err := revel.MainTemplateLoader.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		revel.MainTemplateLoader = oldLoader
+	})
+}
+
+func applyResult(r *RenderLayoutTemplateResult, req *http.Request) *httptest.ResponseRecorder {
+	c, w := testController(req, "html")
+	r.Apply(c.Request, c.Response)
+	return w
+}
+
+func layoutResult(view string) *RenderLayoutTemplateResult {
+	return &RenderLayoutTemplateResult{
+		Template: parseView("Hotels/Show.html", view),
+		Layout:   parseView("application.html", "<body>{{yield .}}</body>"),
+		ViewArgs: map[string]interface{}{"missing": nil},
+	}
+}
+
+func TestETagDependsOnEncoding(t *testing.T) {
+	setConfig(t, map[string]string{
+		"results.etag":              "true",
+		"results.compress":          "true",
+		"results.compress.min_size": "0",
+	})
+	view := strings.Repeat("hotel ", 100)
+
+	plain := applyResult(layoutResult(view), httptest.NewRequest("GET", "/", nil))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	gzipped := applyResult(layoutResult(view), req)
+
+	plainTag, gzipTag := plain.Header().Get("ETag"), gzipped.Header().Get("ETag")
+	if plainTag == "" || gzipTag == "" || plainTag == gzipTag {
+		t.Fatalf("Expected different ETags for each encoding, got %q and %q", plainTag, gzipTag)
+	}
+	if gzipped.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzipped response, got %q", gzipped.Header().Get("Content-Encoding"))
+	}
+
+	// The ETag of the plain body doesn't match the gzipped one.
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	req.Header.Set("If-None-Match", plainTag)
+	if w := applyResult(layoutResult(view), req); w.Code != http.StatusOK {
+		t.Errorf("Expected 200 for the ETag of another encoding, got %d", w.Code)
+	}
+	req.Header.Set("If-None-Match", gzipTag)
+	if w := applyResult(layoutResult(view), req); w.Code != http.StatusNotModified {
+		t.Errorf("Expected 304 for the ETag of the encoding, got %d", w.Code)
+	}
+}
+
+func TestCompressedChunkedErrorKeepsStreamValid(t *testing.T) {
+	setConfig(t, map[string]string{
+		"results.chunked":  "true",
+		"results.compress": "true",
+	})
+	setupTemplates(t, nil, nil)
+	oldDevMode := revel.DevMode
+	revel.DevMode = false
+	defer func() { revel.DevMode = oldDevMode }()
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := applyResult(layoutResult("hotel {{.missing.Name}}"), req)
+
+	if w.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("Expected a gzipped response, got %q", w.Header().Get("Content-Encoding"))
+	}
+	reader, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Anything written after the gzip stream fails as the header of another.
+	if _, err = ioutil.ReadAll(reader); err != nil {
+		t.Errorf("Response was not valid gzip: %v", err)
+	}
+}
+
+func TestContentTypePerFormat(t *testing.T) {
+	setConfig(t, nil)
+	cases := []struct {
+		view, format, contentType string
+	}{
+		{"Hotels/Show.html", "html", "text/html; charset=utf-8"},
+		{"Hotels/Show.txt", "txt", "text/plain; charset=utf-8"},
+		{"Hotels/Show.xml", "xml", "application/xml; charset=utf-8"},
+		{"Hotels/Show.json", "json", "application/json; charset=utf-8"},
+		{"Hotels/Show.csv", "csv", "text/csv; charset=utf-8"},
+		{"Hotels/Show.ics", "ics", "text/calendar; charset=utf-8"},
+		// The extension of the view wins over the format of the request.
+		{"Hotels/Show.csv", "html", "text/csv; charset=utf-8"},
+		// Views without an extension use the format.
+		{"Hotels/Show", "json", "application/json; charset=utf-8"},
+	}
+	for _, c := range cases {
+		r := layoutResult("hotel")
+		r.Template = parseView(c.view, "hotel")
+		controller, w := testController(httptest.NewRequest("GET", "/", nil), c.format)
+		r.Apply(controller.Request, controller.Response)
+		if contentType := w.Header().Get("Content-Type"); contentType != c.contentType {
+			t.Errorf("%s as %s: Expected %q, got %q", c.view, c.format, c.contentType, contentType)
+		}
+	}
+}
+
+func TestContentTypeOverride(t *testing.T) {
+	setConfig(t, nil)
+	cases := []struct {
+		name, result, response, contentType string
+	}{
+		{"from the view", "", "", "text/html; charset=utf-8"},
+		{"set on the response", "", "text/vnd.turbo-stream.html", "text/vnd.turbo-stream.html"},
+		{"set on the result", "application/atom+xml", "", "application/atom+xml"},
+		{"result over response", "application/atom+xml", "text/vnd.turbo-stream.html", "application/atom+xml"},
+	}
+	for _, c := range cases {
+		r := layoutResult("hotel")
+		r.ContentType = c.result
+		controller, w := testController(httptest.NewRequest("GET", "/", nil), "html")
+		controller.Response.ContentType = c.response
+		r.Apply(controller.Request, controller.Response)
+		if contentType := w.Header().Get("Content-Type"); contentType != c.contentType {
+			t.Errorf("%s: Expected %q, got %q", c.name, c.contentType, contentType)
+		}
+	}
+}
+
+// The errors revel's loader gives when a layout fails to parse, and the
+// errors of text/template and html/template while rendering.
+func TestParseTemplateError(t *testing.T) {
+	cases := []struct {
+		message, name string
+		line          int
+		description   string
+	}{
+		{`template: layouts/application.html:3: unexpected "}" in operand`,
+			"layouts/application.html", 3, `unexpected "}" in operand`},
+		{`template: Hotels/Show.txt:2:3: executing "Hotels/Show.txt" at <index .list 5>: error calling index: index out of range: 5`,
+			"Hotels/Show.txt", 2, `executing "Hotels/Show.txt" at <index .list 5>: error calling index: index out of range: 5`},
+		{`template: Hotels/Show.html:2:4: executing "Hotels/Show.html" at <fail>: error calling fail: boom`,
+			"Hotels/Show.html", 2, `executing "Hotels/Show.html" at <fail>: error calling fail: boom`},
+		{`html/template:Hotels/Show.html:2:11: no such template "footer.html"`,
+			"Hotels/Show.html", 2, `no such template "footer.html"`},
+		{`html/template:Application/Register.html:36: no such template "footer.html"`,
+			"Application/Register.html", 36, `no such template "footer.html"`},
+		{`html/template:Hotels/Show.html: ends in a non-text context: {stateURL}`,
+			"", 0, `html/template:Hotels/Show.html: ends in a non-text context: {stateURL}`},
+		{`template: "Hotels/Show.html" is an incomplete or empty template`,
+			"", 0, `template: "Hotels/Show.html" is an incomplete or empty template`},
+	}
+	for _, c := range cases {
+		name, line, description := parseTemplateError(errors.New(c.message))
+		if name != c.name || line != c.line || description != c.description {
+			t.Errorf("%s: Expected %q, %d, %q, got %q, %d, %q",
+				c.message, c.name, c.line, c.description, name, line, description)
+		}
+	}
+}
+
+// Records what had been written when it was flushed.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed []string
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushed = append(f.flushed, f.Body.String())
+}
+
+func TestStreamFlushesHead(t *testing.T) {
+	setConfig(t, map[string]string{"results.stream": "true"})
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	c := writingController(httptest.NewRequest("GET", "/", nil), "html", w)
+
+	r := layoutResult("<h1>Ritz</h1>")
+	r.Layout = parseView("application.html", `<head></head><body>{{yield .}}</body>`)
+	r.Apply(c.Request, c.Response)
+	if w.Body.String() != "<head></head><body><h1>Ritz</h1></body>" {
+		t.Errorf("Unexpected body %q", w.Body.String())
+	}
+	if len(w.flushed) == 0 || w.flushed[0] != "<head></head><body>" {
+		t.Errorf("Expected a flush before the main yield, got %q", w.flushed)
+	}
+	if w.Header().Get("Content-Length") != "" {
+		t.Error("Expected no Content-Length for a streamed response")
+	}
+}
+
+func TestLastModified(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+	oldDevMode := revel.DevMode
+	revel.DevMode = false
+	defer func() { revel.DevMode = oldDevMode }()
+	cases := []struct {
+		name         string
+		method       string
+		headers      map[string]string
+		status       int
+		config       map[string]string
+		expected     int
+		lastModified string
+	}{
+		{"no condition", "GET", nil, 0, nil, 200, "Fri, 01 Mar 2024 12:00:00 GMT"},
+		{"same time", "GET", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, 0, nil,
+			304, "Fri, 01 Mar 2024 12:00:00 GMT"},
+		{"later", "GET", map[string]string{"If-Modified-Since": "Sat, 02 Mar 2024 12:00:00 GMT"}, 0, nil,
+			304, "Fri, 01 Mar 2024 12:00:00 GMT"},
+		{"earlier", "GET", map[string]string{"If-Modified-Since": "Thu, 29 Feb 2024 12:00:00 GMT"}, 0, nil,
+			200, "Fri, 01 Mar 2024 12:00:00 GMT"},
+		{"bad date", "GET", map[string]string{"If-Modified-Since": "yesterday"}, 0, nil,
+			200, "Fri, 01 Mar 2024 12:00:00 GMT"},
+		{"head", "HEAD", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, 0, nil,
+			304, "Fri, 01 Mar 2024 12:00:00 GMT"},
+		{"post", "POST", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, 0, nil,
+			200, "Fri, 01 Mar 2024 12:00:00 GMT"},
+		{"other status", "GET", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, 404, nil,
+			404, "Fri, 01 Mar 2024 12:00:00 GMT"},
+		{"If-None-Match wins", "GET", map[string]string{
+			"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT",
+			"If-None-Match":     `"other"`,
+		}, 0, map[string]string{"results.etag": "true"}, 200, "Fri, 01 Mar 2024 12:00:00 GMT"},
+		{"chunked", "GET", map[string]string{"If-Modified-Since": "Fri, 01 Mar 2024 12:00:00 GMT"}, 0,
+			map[string]string{"results.chunked": "true"}, 200, ""},
+	}
+	for _, c := range cases {
+		setConfig(t, c.config)
+		req := httptest.NewRequest(c.method, "/", nil)
+		for name, value := range c.headers {
+			req.Header.Set(name, value)
+		}
+		r := layoutResult("hotel")
+		r.LastModified = modified
+		r.Status = c.status
+		w := applyResult(r, req)
+
+		if w.Code != c.expected {
+			t.Errorf("%s: Expected %d, got %d", c.name, c.expected, w.Code)
+		}
+		if lastModified := w.Header().Get("Last-Modified"); lastModified != c.lastModified {
+			t.Errorf("%s: Expected Last-Modified %q, got %q", c.name, c.lastModified, lastModified)
+		}
+		if c.expected == 304 && w.Body.Len() > 0 {
+			t.Errorf("%s: Expected no body, got %q", c.name, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package yield
+
+import (
+	core "github.com/acsellers/yield"
+	"github.com/revel/revel"
+	"io"
+	"path"
+	"strings"
+	"sync"
+	textTmpl "text/template"
+)
+
+/*
+revel parses every view with html/template, which would escape a JSON or XML
+view as if it were HTML. Views for other formats, those without an extension in
+core.HTMLExtensions, are parsed again with text/template when they are found,
+with revel's TemplateFuncs plus core.TextFuncs. Views rendered by other template
+engines are left as they are.
+*/
+var (
+	textViewsMu sync.Mutex
+	textViews   = make(map[string]textView)
+)
+
+// A view of revel's, parsed again with text/template.
+type textView struct {
+	*revel.GoTemplate
+	text *textTmpl.Template
+}
+
+func (v textView) Render(wr io.Writer, arg interface{}) error {
+	return v.text.Execute(wr, arg)
+}
+
+// Find a view in revel's templates, see textViews.
+func findView(name string) (revel.Template, error) {
+	tmpl, err := revel.MainTemplateLoader.Template(name)
+	if err != nil {
+		return nil, err
+	}
+	return asTextView(tmpl)
+}
+
+// The view parsed with text/template when it is for a format other than HTML.
+// The parsed view is kept until revel reloads its views.
+func asTextView(tmpl revel.Template) (revel.Template, error) {
+	goTmpl, ok := tmpl.(*revel.GoTemplate)
+	ext := path.Ext(tmpl.Name())
+	if !ok || ext == "" || isHTMLFormat(strings.TrimPrefix(ext, ".")) {
+		return tmpl, nil
+	}
+
+	textViewsMu.Lock()
+	defer textViewsMu.Unlock()
+	if view, found := textViews[tmpl.Name()]; found && view.GoTemplate == goTmpl {
+		return view, nil
+	}
+	text := textTmpl.New(tmpl.Name()).Funcs(textTmpl.FuncMap(revel.TemplateFuncs)).Funcs(core.TextFuncs)
+	if delims := strings.Split(revel.Config.StringDefault("template.go.delimiters", ""), " "); len(delims) == 2 {
+		text.Delims(delims[0], delims[1])
+	}
+	text, err := text.Parse(string(goTmpl.FileBytes))
+	if err != nil {
+		return nil, err
+	}
+	view := textView{goTmpl, text}
+	textViews[tmpl.Name()] = view
+	return view, nil
+}
@@ -0,0 +1,63 @@
+package yield
+
+import (
+	"github.com/revel/revel"
+	"path/filepath"
+	"testing"
+)
+
+func TestTextViewsAreNotEscaped(t *testing.T) {
+	setupTemplates(t, map[string]string{
+		"Hotels/Show.json":  `{"name": {{json .name}}, "rooms": [{{partial "room" .}}]}`,
+		"Hotels/_room.json": `{"view": {{json .name}}}`,
+		"Hotels/Show.xml":   `<hotel name="{{xml .name}}"/>`,
+		"Hotels/Show.html":  `<h1>{{.name}}</h1>`,
+	}, map[string]string{
+		"envelope.json": `{"data": {{yield .}}}`,
+	})
+	cases := []struct {
+		format, layout, expected string
+	}{
+		{"json", "envelope.json", `{"data": {"name": "A\u0026B \u003cSea\u003e", "rooms": [{"view": "A\u0026B \u003cSea\u003e"}]}}`},
+		{"json", "", `{"name": "A\u0026B \u003cSea\u003e", "rooms": [{"view": "A\u0026B \u003cSea\u003e"}]}`},
+		{"xml", "", `<hotel name="A&amp;B &lt;Sea&gt;"/>`},
+		{"html", "", `<h1>A&amp;B &lt;Sea&gt;</h1>`},
+	}
+	for _, c := range cases {
+		lc, w := hotelsController(c.format)
+		lc.ViewArgs["name"] = "A&B <Sea>"
+		lc.Layout(c.layout)
+		lc.renderAction().Apply(lc.Request, lc.Response)
+		if w.Body.String() != c.expected {
+			t.Errorf("%s in %q: Expected %s, got %s", c.format, c.layout, c.expected, w.Body.String())
+		}
+	}
+}
+
+// Views are parsed again once revel reloads them.
+func TestTextViewsReload(t *testing.T) {
+	setupTemplates(t, map[string]string{
+		"Hotels/Show.json": `{"version": 1}`,
+	}, nil)
+	render := func() string {
+		lc, w := hotelsController("json")
+		lc.Layout("")
+		lc.renderAction().Apply(lc.Request, lc.Response)
+		return w.Body.String()
+	}
+	if body := render(); body != `{"version": 1}` {
+		t.Fatalf("Expected the first version, got %s", body)
+	}
+
+	view, err := findView("Hotels/Show.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, filepath.Join(filepath.Dir(view.Location()), "Show.json"), `{"version": 2}`)
+	if err := revel.MainTemplateLoader.Refresh(); err != nil {
+		t.Fatal(err)
+	}
+	if body := render(); body != `{"version": 2}` {
+		t.Errorf("Expected the second version, got %s", body)
+	}
+}
@@ -0,0 +1,51 @@
+// revel's Watcher.Listen replaces the channels of the fsnotify watcher after it
+// has started reading from them, which the race detector reports.
+
+//go:build !race
+// +build !race
+
+package yield
+
+import (
+	"github.com/revel/revel"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLayoutsReloadAfterEngineStart(t *testing.T) {
+	dir := setupLayouts(t, map[string]string{"application.html": "old {{yield .}}"})
+	revel.DevMode = true
+
+	// revel runs the app start hooks, which load the layouts, before it
+	// creates its watcher, and raises ENGINE_STARTED after.
+	revel.MainWatcher = nil
+	if layouts() == nil || layoutErr != nil {
+		t.Fatalf("Layouts failed to load: %v", layoutErr)
+	}
+	revel.MainWatcher = revel.NewWatcher()
+	watchLayoutsOnStart(revel.ENGINE_STARTED, nil)
+
+	if err := revel.MainWatcher.Notify(); err != nil {
+		t.Fatal(err)
+	}
+	if out := renderLayout(t, "application"); out != "old main" {
+		t.Fatalf("Rendered %q before the change", out)
+	}
+
+	writeFile(t, filepath.Join(dir, "application.html"), "new {{yield .}}")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := revel.MainWatcher.Notify(); err != nil {
+			t.Fatal(err)
+		}
+		out := renderLayout(t, "application")
+		if out == "new main" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Layout was not reloaded, rendered %q", out)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -13,88 +13,106 @@ that is why you embed yield.Controller not controllers.Controller.
 
 The booking sample from revel was ported to use the basic yield
 mechanism and is available in the samples directory.
+
+This package is a thin wrapper for revel over the github.com/acsellers/yield
+package, which can be used with plain net/http handlers as well.
 */
 package yield
 
 import (
-	"bytes"
-	"fmt"
-	"github.com/robfig/revel"
+	core "github.com/acsellers/yield"
+	"github.com/revel/revel"
 	htmlTmpl "html/template"
+	"io"
+	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync"
+	"time"
 )
 
 /*
-To set your directory for loading layouts from, set the LayoutPath variable to the location
-relative to the base of your revel directory. You can only set one directory at the moment.
+To set the directories for loading layouts from, set the LayoutPaths variable to the locations
+relative to the base of your revel directory, or absolute paths. Layouts are also loaded from the
+ModuleLayoutPath directory of each revel module, if it exists. When a layout of the same name is in
+more than one directory, the first one wins: earlier LayoutPaths win over later ones, and your app's
+directories win over the modules'. In dev mode with watch enabled, layouts are reloaded when they
+change, just like views.
 
 To set a default layout, take the format you wish that layout to apply for, i.e. "html", then set
-that string to the name of the layout you want to render.
+that string to the name of the layout you want to render. Layouts for formats other than HTML, such
+as an envelope for JSON responses, are parsed with text/template so they are not escaped as HTML.
+They can use the json and xml functions to escape values, i.e. with DefaultLayout["json"] =
+"envelope.json" and a layout of
+
+	{"data": {{yield .}}, "meta": {"user": {{json .user}}}}
+
+Views for those formats, i.e. "Hotels/Show.json", are parsed again with text/template as well when
+they are rendered, as revel parses every view with html/template. Each is parsed on its own, so they
+cannot include another file with {{template}}, use partial instead.
+
+To set a layout for every action of a controller, set ControllerLayout for the controller name,
+i.e. ControllerLayout["Hotels"] = "hotels.html". To set one for a single action, use the controller
+and action name, i.e. ControllerLayout["Hotels.List"] = "". An empty layout name renders no layout.
+Layouts are picked by precedence: one set with Controller.Layout, then the action's, then the
+controller's, then the DefaultLayout for the format. A ControllerLayout with an extension, i.e.
+"hotels.html", only applies to requests of that format; leave the extension off to apply it to
+every format, in which case a layout for each format must exist.
+
+To nest a layout inside another, set ParentLayout for the name of the inner layout to the name of
+the outer layout, i.e. ParentLayout["admin.html"] = "application.html". The inner layout is rendered
+first and its output becomes the main yield of the outer layout. Named yields are available at every
+level. Parents may be chained as deeply as you like, as long as no layout is its own ancestor.
+
+HTML requests from PJAX, Turbo or any script swapping part of a page into one that already has a
+layout are rendered without one. They are told apart by having any of the PartialHeaders, requests
+for other formats, i.e. JSON, keep their layout whatever their headers. A layout set with
+Controller.Layout is still used for them. When the request names a region of the page with one of
+RegionHeaders, i.e. Turbo-Frame: sidebar, and the view added content for a named yield of that name,
+only that content is sent. As the head of the page is not rendered, the named yields in
+FragmentHeaders are sent in response headers instead, escaped with url.PathEscape, so the script can
+update the title.
 */
 var (
-	LayoutPath      = "app/layouts"
-	DefaultLayout   = make(map[string]string)
-	layoutTemplates *revel.TemplateLoader
+	LayoutPaths      = []string{"app/layouts"}
+	ModuleLayoutPath = "app/layouts"
+	DefaultLayout    = make(map[string]string)
+	ControllerLayout = make(map[string]string)
+	ParentLayout     = make(map[string]string)
+	PartialHeaders   = []string{"X-Requested-With", "X-PJAX", "Turbo-Frame"}
+	RegionHeaders    = []string{"Turbo-Frame", "X-PJAX-Container"}
+	FragmentHeaders  = map[string]string{"title": "X-Page-Title", "head": "X-Page-Head"}
+	layoutTemplates  *core.Loader
+	layoutErr        *revel.Error
+	layoutsOnce      sync.Once
+	watchOnce        sync.Once
 )
 
 func init() {
-	revel.TemplateFuncs["could_yield"] = func(name string, renderArgs map[string]interface{}) bool {
-		if items, found := renderArgs["ContentForItems"]; found {
-			if renderTmpl, ok := items.(map[string]revel.Template); ok {
-				_, found := renderTmpl[name]
-				return found
+	// Load the layouts as the app starts, so a broken layout is reported then
+	// rather than on the first request. In dev mode the app is left running so
+	// the error page can show it and the watcher can pick up the fix.
+	revel.OnAppStart(func() {
+		layouts()
+		if layoutErr != nil {
+			if revel.DevMode {
+				revel.AppLog.Error("Failed to load layouts", "error", layoutErr)
 			} else {
-				return false
+				revel.AppLog.Fatal("Failed to load layouts", "error", layoutErr)
 			}
-		} else {
-			return false
 		}
-	}
+	})
 
-	revel.TemplateFuncs["yield"] = func(args ...interface{}) (htmlTmpl.HTML, error) {
-		var renderArgs map[string]interface{}
-		var target string
+	revel.AddInitEventHandler(watchLayoutsOnStart)
 
-		switch len(args) {
-		case 1:
-			if r_arg, ok := args[0].(map[string]interface{}); ok {
-				renderArgs = r_arg
-			} else {
-				return "", fmt.Errorf("Must pass dot into yield")
-			}
-		case 2:
-			if t_arg, ok := args[0].(string); ok {
-				target = t_arg
-			} else {
-				return "", fmt.Errorf("Named yields require the name as the first argument")
-			}
-			if r_arg, ok := args[1].(map[string]interface{}); ok {
-				renderArgs = r_arg
-			} else {
-				return "", fmt.Errorf("Named yields require the dot as the second argument")
-			}
-		default:
-			return "", fmt.Errorf("Yield: Argument Length Error")
-		}
-
-		if items, found := renderArgs["ContentForItems"]; found {
-			if renderTmpl, ok := items.(map[string]revel.Template); ok {
-				if tmpl, found := renderTmpl[target]; found {
-					var b bytes.Buffer
-					err := tmpl.Render(&b, renderArgs)
-					if err != nil {
-						return "", err
-					}
-					return htmlTmpl.HTML(b.String()), nil
-				}
-				return "", nil
-			} else {
-				return "", fmt.Errorf("Yield: ContentForItems was overwritten")
-			}
-		} else {
-			return "", fmt.Errorf("Yield requires the base RenderArgs")
-		}
+	for name, fn := range core.Funcs {
+		revel.TemplateFuncs[name] = fn
+	}
+	// Views for formats other than HTML are rendered with text/template, see
+	// textViews, but revel parses them first and needs their functions too.
+	for name, fn := range core.TextFuncs {
+		revel.TemplateFuncs[name] = fn
 	}
 }
 
@@ -105,16 +123,16 @@ controller.
 */
 type Controller struct {
 	*revel.Controller
-	RenderTmpl map[string]revel.Template
-	LayoutPath string
-	noLayout   bool
+	LayoutPath   string
+	noLayout     bool
+	lastModified time.Time
 }
 
 /*
 Set the layout to be rendered for the current action. Setting the layout
 to empty string will cause no layout to be rendered. No layout will be rendered
-if you did not set a Default layout for the current request format and you
-do not call this function to set a specific layout. You do not have to include
+if you did not set a ControllerLayout or Default layout for the current request
+and you do not call this function to set a specific layout. You do not have to include
 the format for the template, that will be added, but adding it the format would
 not cause a problem.
 */
@@ -130,35 +148,147 @@ func (lc *Controller) Layout(s string) {
 The same kind of function as calling Render on revel.Controller, except that
 this will pick up the Layout you specified and render that as well.
 */
-func (lc *Controller) Render(extraRenderArgs ...interface{}) revel.Result {
-	// Get the calling function name.
-	_, _, line, ok := runtime.Caller(1)
+func (lc *Controller) Render(extraViewArgs ...interface{}) revel.Result {
+	lc.setViewArgs(extraViewArgs)
+	return lc.renderAction()
+}
+
+/*
+The same as Render, except the response is sent with the status code given,
+i.e. to render a laid out 404 or 422 page. Errors while rendering are still
+sent with a 500 status.
+*/
+func (lc *Controller) RenderWithStatus(status int, extraViewArgs ...interface{}) revel.Result {
+	lc.setViewArgs(extraViewArgs)
+	result := lc.renderAction()
+	switch r := result.(type) {
+	case *RenderLayoutTemplateResult:
+		r.Status = status
+	case LayoutErrorResult:
+	default:
+		lc.Response.Status = status
+	}
+	return result
+}
+
+// Set the extra ViewArgs passed to Render or RenderWithStatus under the
+// names they were given in the action.
+func (lc *Controller) setViewArgs(extraViewArgs []interface{}) {
+	// Get the calling function name, skipping the Render call.
+	_, _, line, ok := runtime.Caller(2)
 	if !ok {
-		revel.ERROR.Println("Failed to get Caller information")
+		revel.AppLog.Error("Failed to get Caller information")
 	}
 
-	// Get the extra RenderArgs passed in.
+	// Get the extra ViewArgs passed in.
 	if renderArgNames, ok := lc.MethodType.RenderArgNames[line]; ok {
-		if len(renderArgNames) == len(extraRenderArgs) {
-			for i, extraRenderArg := range extraRenderArgs {
-				lc.RenderArgs[renderArgNames[i]] = extraRenderArg
+		if len(renderArgNames) == len(extraViewArgs) {
+			for i, extraViewArg := range extraViewArgs {
+				lc.ViewArgs[renderArgNames[i]] = extraViewArg
 			}
 		} else {
-			revel.ERROR.Println(len(renderArgNames), "RenderArg names found for",
-				len(extraRenderArgs), "extra RenderArgs")
+			revel.AppLog.Errorf("%d RenderArg names found for %d extra ViewArgs",
+				len(renderArgNames), len(extraViewArgs))
 		}
 	} else {
-		revel.ERROR.Println("No RenderArg names found for Render call on line", line,
-			"(Method", lc.MethodType.Name, ")")
+		revel.AppLog.Errorf("No RenderArg names found for Render call on line %d (Method %s)",
+			line, lc.MethodType.Name)
 	}
-	if lc.noLayout || DefaultLayout[lc.Request.Format] == "" {
-		return lc.RenderTemplate(lc.Name + "/" + lc.MethodType.Name + "." + lc.Request.Format)
-	} else {
-		if lc.LayoutPath == "" {
-			lc.LayoutPath = DefaultLayout[lc.Request.Format]
+}
+
+// Render the template for the current action, with its layout if it has one.
+func (lc *Controller) renderAction() revel.Result {
+	templatePath := lc.Name + "/" + lc.MethodType.Name + "." + lc.Request.Format
+	if len(PartialHeaders) > 0 && isHTMLFormat(lc.Request.Format) {
+		lc.Response.Out.Header().Add("Vary", strings.Join(PartialHeaders, ", "))
+	}
+	if lc.isPartialRequest() && lc.LayoutPath == "" {
+		return lc.renderPartialRequest(templatePath)
+	}
+	if layout := lc.layoutName(); layout != "" {
+		lc.LayoutPath = layout
+		return lc.RenderTemplateWithLayout(templatePath)
+	}
+	// Not revel's RenderTemplate, which doesn't give the view its ContentStore
+	// for partials and content_for, and renders every view as HTML.
+	template, err := findView(templatePath)
+	if err != nil {
+		return lc.RenderError(err)
+	}
+	return &RenderLayoutTemplateResult{
+		Template:     template,
+		ViewArgs:     lc.ViewArgs,
+		Content:      lc.Content(),
+		LastModified: lc.lastModified,
+	}
+}
+
+// Whether the request is for HTML and has any of the PartialHeaders. Scripts
+// send the same headers when fetching JSON or XML, which keep their layouts.
+func (lc *Controller) isPartialRequest() bool {
+	if !isHTMLFormat(lc.Request.Format) {
+		return false
+	}
+	for _, header := range PartialHeaders {
+		if lc.Request.GetHttpHeader(header) != "" {
+			return true
 		}
-		return lc.RenderTemplateWithLayout(lc.Name + "/" + lc.MethodType.Name + "." + lc.Request.Format)
 	}
+	return false
+}
+
+func isHTMLFormat(format string) bool {
+	for _, ext := range core.HTMLExtensions {
+		if "."+format == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Render the template without a layout, for a request with PartialHeaders.
+func (lc *Controller) renderPartialRequest(templatePath string) revel.Result {
+	template, err := findView(templatePath)
+	if err != nil {
+		return lc.RenderError(err)
+	}
+
+	var region string
+	for _, header := range RegionHeaders {
+		if region = strings.TrimPrefix(lc.Request.GetHttpHeader(header), "#"); region != "" {
+			break
+		}
+	}
+	return &RenderLayoutTemplateResult{
+		Template:     template,
+		ViewArgs:     lc.ViewArgs,
+		Content:      lc.Content(),
+		LastModified: lc.lastModified,
+		Partial:      true,
+		Region:       region,
+	}
+}
+
+// The layout for the current action, following the precedence described
+// for ControllerLayout.
+func (lc *Controller) layoutName() string {
+	if lc.noLayout {
+		return ""
+	}
+	if lc.LayoutPath != "" {
+		return lc.LayoutPath
+	}
+	for _, key := range []string{lc.Name + "." + lc.MethodType.Name, lc.Name} {
+		if layout, found := ControllerLayout[key]; found && layoutHasFormat(layout, lc.Request.Format) {
+			return layout
+		}
+	}
+	return DefaultLayout[lc.Request.Format]
+}
+
+func layoutHasFormat(layout, format string) bool {
+	ext := filepath.Ext(layout)
+	return ext == "" || ext == "."+format
 }
 
 /*
@@ -168,51 +298,220 @@ rendered, you should use RenderTemplate which is available. This call expects
 an actual layout to be rendered, failing to provide one is an error.
 */
 func (lc *Controller) RenderTemplateWithLayout(templatePath string) revel.Result {
-	if layoutTemplates == nil {
-		err := loadLayouts()
-		if err != nil {
-			return lc.RenderError(err)
-		}
-	}
-
 	// Get the Template.
-	template, err := revel.MainTemplateLoader.Template(templatePath)
+	template, err := findView(templatePath)
 	if err != nil {
 		return lc.RenderError(err)
 	}
-	layout, err := layoutTemplates.Template(lc.LayoutPath)
+	layouts, err := core.LayoutChain(lc.LayoutPath, ParentLayout, func(name string) (core.Template, error) {
+		return findLayout(name, lc.Request.Format)
+	})
 	if err != nil {
-		layout, err = layoutTemplates.Template(lc.LayoutPath + "." + lc.Request.Format)
-		if err != nil {
-			return lc.RenderError(err)
-		}
+		return lc.RenderError(err)
 	}
 
 	return &RenderLayoutTemplateResult{
-		Template:   template,
-		Layout:     layout,
-		RenderArgs: lc.RenderArgs,
-		RenderTmpl: map[string]revel.Template{},
+		Template:     template,
+		Layout:       layouts[0],
+		Parents:      layouts[1:],
+		ViewArgs:     lc.ViewArgs,
+		Content:      lc.Content(),
+		LastModified: lc.lastModified,
 	}
 }
 
+/*
+Set when what the current action shows was last changed, i.e. the UpdatedAt
+of the record it renders. It is sent as the Last-Modified header of the laid
+out response, which is answered with 304 Not Modified when the client's copy
+is at least as new.
+*/
+func (lc *Controller) SetLastModified(modified time.Time) {
+	lc.lastModified = modified
+}
+
+// The layout loader, loaded on first use if the app start hook has not
+// already done so. Safe to call from concurrent requests.
+func layouts() *core.Loader {
+	layoutsOnce.Do(func() {
+		layoutErr = loadLayouts()
+	})
+	return layoutTemplates
+}
+
 func loadLayouts() *revel.Error {
-	layoutTemplates = revel.NewTemplateLoader([]string{filepath.Join(revel.BasePath, LayoutPath)})
-	return layoutTemplates.Refresh()
+	layoutTemplates = core.NewLoader(layoutDirs(), htmlTmpl.FuncMap(revel.TemplateFuncs))
+	return layoutListener{layoutTemplates}.Refresh()
+}
+
+// revel creates its watcher after running the app start hooks, so the layouts
+// are only watched once the engine has started.
+func watchLayoutsOnStart(event revel.Event, value interface{}) revel.EventResponse {
+	if event == revel.ENGINE_STARTED {
+		watchLayouts()
+	}
+	return 0
+}
+
+// In dev mode, have revel's watcher refresh the layouts when they change, the
+// same way it does for views. Otherwise they are loaded once and cached.
+func watchLayouts() {
+	if !revel.DevMode || revel.MainWatcher == nil || !revel.Config.BoolDefault("watch.templates", true) {
+		return
+	}
+	watchOnce.Do(func() {
+		loader := layouts()
+		revel.MainWatcher.Listen(layoutListener{loader}, loader.Paths...)
+	})
+}
+
+// Lets revel's watcher reload the layouts when they change.
+type layoutListener struct {
+	*core.Loader
+}
+
+func (l layoutListener) Refresh() *revel.Error {
+	err := l.Load()
+	if err == nil {
+		return nil
+	}
+	templateName, line, description := parseTemplateError(err)
+	return &revel.Error{
+		Title:       "Layout Compilation Error",
+		Path:        templateName,
+		Description: description,
+		Line:        line,
+	}
+}
+
+func (l layoutListener) WatchDir(info os.FileInfo) bool {
+	return !strings.HasPrefix(info.Name(), ".")
+}
+
+func (l layoutListener) WatchFile(basename string) bool {
+	return !strings.HasPrefix(basename, ".")
+}
+
+// The directories to load layouts from, in order of precedence.
+func layoutDirs() []string {
+	var dirs []string
+	for _, path := range LayoutPaths {
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(revel.BasePath, path)
+		}
+		dirs = append(dirs, path)
+	}
+	for _, module := range revel.Modules {
+		path := filepath.Join(module.Path, ModuleLayoutPath)
+		if info, err := os.Stat(path); err == nil && info.IsDir() {
+			dirs = append(dirs, path)
+		}
+	}
+	return dirs
+}
+
+// Find a layout by name, trying the name with the request format appended
+// if the bare name is not found.
+func findLayout(name, format string) (core.Template, error) {
+	loader := layouts()
+	layout, err := loader.Template(name)
+	if err != nil {
+		layout, err = loader.Template(name + "." + format)
+	}
+	return layout, err
 }
 
-// Set a template from your main revel Template library to be rendered into
+// Add a template from your main revel Template library to the end of
 // a named yield.
 func (lc *Controller) ContentFor(yieldName, templateName string) error {
-	template, err := revel.MainTemplateLoader.Template(templateName)
+	template, err := lc.contentTemplate(templateName)
 	if err != nil {
-		template, err = revel.MainTemplateLoader.Template(lc.Name + "/" + templateName)
-		if err != nil {
-			return err
+		return err
+	}
+	lc.Content().Append(yieldName, template)
+	return nil
+}
+
+// Add a template from your main revel Template library to the start of
+// a named yield.
+func (lc *Controller) PrependContentFor(yieldName, templateName string) error {
+	template, err := lc.contentTemplate(templateName)
+	if err != nil {
+		return err
+	}
+	lc.Content().Prepend(yieldName, template)
+	return nil
+}
+
+// Add a fragment of HTML to the end of a named yield.
+func (lc *Controller) ContentForHTML(yieldName string, html htmlTmpl.HTML) {
+	lc.Content().AppendHTML(yieldName, html)
+}
+
+/*
+The ContentStore for the current request, created on first use. It is kept
+in the ViewArgs, so interceptors and actions share the same store even when
+they are called on different copies of your controller.
+*/
+func (lc *Controller) Content() *core.ContentStore {
+	content := core.Store(lc.ViewArgs)
+	content.Lookup = lookupView
+	content.Dir = lc.Name
+	content.Format = lc.Request.Format
+	return content
+}
+
+// Find a view in revel's templates, for content_for_block.
+func lookupView(name string) (core.Template, error) {
+	return findView(name)
+}
+
+// Find a view in revel's templates, or a template declared with {{define}}
+// alongside the main template, which revel's loader does not look up.
+func lookupViewFrom(main revel.Template) func(string) (core.Template, error) {
+	return func(name string) (core.Template, error) {
+		tmpl, err := lookupView(name)
+		if err == nil {
+			return tmpl, nil
+		}
+		switch view := main.(type) {
+		case *revel.GoTemplate:
+			if view.Template == nil {
+				break
+			}
+			if defined := view.Lookup(name); defined != nil {
+				return definedTemplate{defined}, nil
+			}
+		case textView:
+			if defined := view.text.Lookup(name); defined != nil {
+				return definedTemplate{defined}, nil
+			}
 		}
+		return nil, err
+	}
+}
+
+// A template declared with {{define}}, from either html/template or
+// text/template.
+type definedTemplate struct {
+	executor interface {
+		Name() string
+		Execute(wr io.Writer, data interface{}) error
 	}
+}
 
-	lc.RenderTmpl[yieldName] = template
+func (t definedTemplate) Name() string {
+	return t.executor.Name()
+}
 
-	return nil
+func (t definedTemplate) Render(wr io.Writer, arg interface{}) error {
+	return t.executor.Execute(wr, arg)
+}
+
+func (lc *Controller) contentTemplate(templateName string) (revel.Template, error) {
+	template, err := findView(templateName)
+	if err != nil {
+		template, err = findView(lc.Name + "/" + templateName)
+	}
+	return template, err
 }
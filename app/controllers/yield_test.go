@@ -0,0 +1,318 @@
+package yield
+
+import (
+	"bytes"
+	core "github.com/acsellers/yield"
+	"github.com/revel/config"
+	"github.com/revel/revel"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// Point the layout loader at a fresh directory holding the files, undoing
+// everything once the test is done.
+func setupLayouts(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		writeFile(t, filepath.Join(dir, name), content)
+	}
+
+	oldPaths, oldConfig, oldDevMode, oldWatcher := LayoutPaths, revel.Config, revel.DevMode, revel.MainWatcher
+	LayoutPaths = []string{dir}
+	if revel.Config == nil {
+		revel.Config = config.NewContext()
+	}
+	resetLayouts()
+	t.Cleanup(func() {
+		LayoutPaths, revel.Config, revel.DevMode, revel.MainWatcher = oldPaths, oldConfig, oldDevMode, oldWatcher
+		resetLayouts()
+	})
+	return dir
+}
+
+func resetLayouts() {
+	layoutTemplates, layoutErr = nil, nil
+	layoutsOnce, watchOnce = sync.Once{}, sync.Once{}
+}
+
+func writeFile(t *testing.T, name, content string) {
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// A revel Controller for a request, with the Format set as revel's router
+// would, and the recorder its response is written to.
+func testController(r *http.Request, format string) (*revel.Controller, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	return writingController(r, format, w), w
+}
+
+// The same as testController, writing the response to w.
+func writingController(r *http.Request, format string, w http.ResponseWriter) *revel.Controller {
+	context := revel.NewGoContext(nil)
+	context.Request.SetRequest(r)
+	context.Response.SetResponse(w)
+	c := revel.NewController(context)
+	c.Request.Format = format
+	return c
+}
+
+// Use a fresh app.conf with the options set, for the rest of the test.
+func setConfig(t *testing.T, options map[string]string) {
+	oldConfig := revel.Config
+	revel.Config = config.NewContext()
+	for name, value := range options {
+		revel.Config.SetOption(name, value)
+	}
+	t.Cleanup(func() {
+		revel.Config = oldConfig
+	})
+}
+
+// Render a view of "main" inside the layout.
+func renderLayout(t *testing.T, name string) string {
+	layout, err := findLayout(name, "html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	args := map[string]interface{}{}
+	err = core.Execute(&b, core.Fragment("view", "main"), []core.Template{layout}, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// Run with -race, first renders from concurrent requests must not race on
+// loading the layouts.
+func TestConcurrentFirstRender(t *testing.T) {
+	setupLayouts(t, map[string]string{
+		"application.html": `<title>{{yield "title" .}}</title>{{yield .}}`,
+		"admin.html":       `<div>{{yield .}}</div>`,
+	})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			chain, err := core.LayoutChain("admin", map[string]string{"admin": "application"}, func(name string) (core.Template, error) {
+				return findLayout(name, "html")
+			})
+			if err != nil {
+				errs <- err
+				return
+			}
+			var b bytes.Buffer
+			args := map[string]interface{}{}
+			core.Store(args).AppendHTML("title", "Admin")
+			err = core.Execute(&b, core.Fragment("view", "main"), chain, args)
+			if err == nil && b.String() != "<title>Admin</title><div>main</div>" {
+				t.Errorf("Rendered %q", b.String())
+			}
+			if err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// A Controller for the Show action of Hotels, for the format.
+func hotelsController(format string) (*Controller, *httptest.ResponseRecorder) {
+	return hotelsControllerFor(httptest.NewRequest("GET", "/hotels/1", nil), format)
+}
+
+// The same as hotelsController, for the request.
+func hotelsControllerFor(r *http.Request, format string) (*Controller, *httptest.ResponseRecorder) {
+	c, w := testController(r, format)
+	c.Name = "Hotels"
+	c.MethodType = &revel.MethodType{Name: "Show"}
+	return &Controller{Controller: c}, w
+}
+
+func TestContentForRendersInLayout(t *testing.T) {
+	setupTemplates(t, map[string]string{
+		"Hotels/Show.html":    `<h1>{{.name}}</h1>`,
+		"Hotels/sidebar.html": `<p>Near {{.name}}</p>`,
+		"shared/ad.html":      `<p>Ad</p>`,
+	}, map[string]string{
+		"application.html": `<aside>{{yield "sidebar" .}}</aside><main>{{yield .}}</main>`,
+	})
+
+	cases := []struct {
+		name    string
+		content func(lc *Controller) error
+		aside   string
+	}{
+		{"view of the controller", func(lc *Controller) error {
+			return lc.ContentFor("sidebar", "sidebar.html")
+		}, "<p>Near Ritz</p>"},
+		{"full view name", func(lc *Controller) error {
+			return lc.ContentFor("sidebar", "shared/ad.html")
+		}, "<p>Ad</p>"},
+		{"in order", func(lc *Controller) error {
+			if err := lc.ContentFor("sidebar", "sidebar.html"); err != nil {
+				return err
+			}
+			lc.ContentForHTML("sidebar", "<hr>")
+			return lc.PrependContentFor("sidebar", "shared/ad.html")
+		}, "<p>Ad</p><p>Near Ritz</p><hr>"},
+		{"nothing", func(lc *Controller) error {
+			return nil
+		}, ""},
+	}
+	for _, c := range cases {
+		lc, w := hotelsController("html")
+		lc.Layout("application")
+		lc.ViewArgs["name"] = "Ritz"
+		if err := c.content(lc); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		result := lc.RenderTemplateWithLayout("Hotels/Show.html")
+		result.Apply(lc.Request, lc.Response)
+
+		expected := "<aside>" + c.aside + "</aside><main><h1>Ritz</h1></main>"
+		if body := w.Body.String(); body != expected {
+			t.Errorf("%s: Expected %q, got %q", c.name, expected, body)
+		}
+	}
+}
+
+func TestContentForMissingView(t *testing.T) {
+	setupTemplates(t, nil, nil)
+	lc, _ := hotelsController("html")
+	if err := lc.ContentFor("sidebar", "sidebar.html"); err == nil {
+		t.Error("Expected an error for a view that doesn't exist")
+	}
+	if lc.Content().Has("sidebar") {
+		t.Error("Expected nothing to be added for a view that doesn't exist")
+	}
+}
+
+// Interceptors and actions run on different copies of the controller, but
+// share the ViewArgs, and so the content.
+func TestContentForSharedBetweenCopies(t *testing.T) {
+	setupTemplates(t, map[string]string{
+		"Hotels/sidebar.html": `<p>Sidebar</p>`,
+	}, nil)
+	lc, _ := hotelsController("html")
+	interceptor := *lc
+	if err := interceptor.ContentFor("sidebar", "sidebar.html"); err != nil {
+		t.Fatal(err)
+	}
+	html, err := lc.Content().Render("sidebar", lc.ViewArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(html), "Sidebar") {
+		t.Errorf("Expected the sidebar, got %q", html)
+	}
+}
+
+// Partials declared with {{define}} in the view are found, as revel's loader
+// doesn't look them up.
+func TestPartialDefinedInView(t *testing.T) {
+	setupTemplates(t, map[string]string{
+		"Hotels/Show.html": `{{define "_row.html"}}<li>{{.name}}</li>{{end}}<ul>{{partial "row" .}}</ul>`,
+	}, map[string]string{
+		"application.html": `<main>{{yield .}}</main>`,
+	})
+	lc, w := hotelsController("html")
+	lc.Layout("application")
+	lc.ViewArgs["name"] = "Ritz"
+	lc.RenderTemplateWithLayout("Hotels/Show.html").Apply(lc.Request, lc.Response)
+	if expected := "<main><ul><li>Ritz</li></ul></main>"; w.Body.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, w.Body.String())
+	}
+}
+
+// Views rendered without a layout still get their ContentStore.
+func TestPartialWithoutLayout(t *testing.T) {
+	setupTemplates(t, map[string]string{
+		"Hotels/Show.html":  `{{content_for "title" .name .}}<ul>{{partial "room" .}}{{render_collection "room" .rooms .}}</ul>`,
+		"Hotels/_room.html": `<li>{{.name}}</li>`,
+	}, nil)
+	lc, w := hotelsController("html")
+	lc.Layout("")
+	lc.ViewArgs["name"] = "Ritz"
+	lc.ViewArgs["rooms"] = []string{"A"}
+	lc.renderAction().Apply(lc.Request, lc.Response)
+	if w.Code != 200 {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if expected := "<ul><li>Ritz</li><li>Ritz</li></ul>"; w.Body.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, w.Body.String())
+	}
+	if !lc.Content().Has("title") {
+		t.Error("Expected the title set by the view")
+	}
+}
+
+// Use the DefaultLayout and ControllerLayout for the rest of the test.
+func setLayoutNames(t *testing.T, defaults, controllers map[string]string) {
+	oldDefault, oldController := DefaultLayout, ControllerLayout
+	DefaultLayout, ControllerLayout = defaults, controllers
+	t.Cleanup(func() {
+		DefaultLayout, ControllerLayout = oldDefault, oldController
+	})
+}
+
+func TestLayoutName(t *testing.T) {
+	cases := []struct {
+		name        string
+		format      string
+		set         string
+		controllers map[string]string
+		expected    string
+	}{
+		{"default for the format", "html", "-", nil, "application"},
+		{"default for another format", "json", "-", nil, "envelope.json"},
+		{"no default", "xml", "-", nil, ""},
+		{"controller", "html", "-", map[string]string{"Hotels": "hotels"}, "hotels"},
+		{"action over controller", "html", "-",
+			map[string]string{"Hotels": "hotels", "Hotels.Show": "show"}, "show"},
+		{"action opting out", "html", "-",
+			map[string]string{"Hotels": "hotels", "Hotels.Show": ""}, ""},
+		{"controller opting out", "html", "-", map[string]string{"Hotels": ""}, ""},
+		{"extension of the format", "html", "-", map[string]string{"Hotels": "hotels.html"}, "hotels.html"},
+		{"extension of another format", "json", "-", map[string]string{"Hotels": "hotels.html"}, "envelope.json"},
+		{"action for another format", "json", "-",
+			map[string]string{"Hotels": "hotels", "Hotels.Show": "show.html"}, "hotels"},
+		{"no extension for every format", "json", "-", map[string]string{"Hotels": "hotels"}, "hotels"},
+		{"set on the controller", "html", "admin",
+			map[string]string{"Hotels": "hotels", "Hotels.Show": "show"}, "admin"},
+		{"set to none", "html", "",
+			map[string]string{"Hotels": "hotels", "Hotels.Show": "show"}, ""},
+	}
+	for _, c := range cases {
+		controllers := c.controllers
+		if controllers == nil {
+			controllers = map[string]string{}
+		}
+		setLayoutNames(t, map[string]string{"html": "application", "json": "envelope.json"}, controllers)
+		lc, _ := hotelsController(c.format)
+		if c.set != "-" {
+			lc.Layout(c.set)
+		}
+		if layout := lc.layoutName(); layout != c.expected {
+			t.Errorf("%s: Expected %q, got %q", c.name, c.expected, layout)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package yield
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Buffers larger than this are left for the garbage collector rather than
+// pooled, so one huge page doesn't keep its memory around.
+const maxPooledBuffer = 1 << 20
+
+var buffers = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// An empty buffer from the pool shared by the yields, partials and layouts,
+// return it with PutBuffer once its contents are no longer needed.
+func GetBuffer() *bytes.Buffer {
+	return buffers.Get().(*bytes.Buffer)
+}
+
+// Return a buffer from GetBuffer to the pool. It must not be used afterwards.
+func PutBuffer(b *bytes.Buffer) {
+	if b.Cap() > maxPooledBuffer {
+		return
+	}
+	b.Reset()
+	buffers.Put(b)
+}
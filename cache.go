@@ -0,0 +1,174 @@
+package yield
+
+import (
+	"fmt"
+	"html/template"
+	"sync"
+	"time"
+)
+
+/*
+A FragmentCache stores the rendered HTML of named yields for cached_yield.
+Set stores html under key for ttl, or forever when ttl is zero. Get reports
+whether key was found and has not expired. Implementations must be safe for
+concurrent use.
+*/
+type FragmentCache interface {
+	Get(key string) (template.HTML, bool)
+	Set(key string, html template.HTML, ttl time.Duration)
+	Delete(key string)
+}
+
+/*
+Cache is where cached_yield keeps rendered yields, for CacheTTL each. It is
+kept in memory by default, replace it to share fragments between processes,
+i.e. with the revel Controller's RevelFragmentCache.
+*/
+var (
+	Cache    FragmentCache = NewMemoryCache()
+	CacheTTL               = 10 * time.Minute
+)
+
+/*
+Render the named yield once for each cache key and reuse the HTML until it
+expires, or is removed with ExpireFragment. The cache key is anything that
+identifies the data the yield shows, i.e. the id of the signed in user for
+a sidebar showing their details:
+
+	{{cached_yield "sidebar" .user.Id .}}
+
+The content of the yield must still be registered on every request, as that
+is what is rendered once the fragment expires; caching saves rendering it, not
+setting it up. Nothing is cached while nothing is registered for the yield, so
+a request missing the content doesn't leave the fragment empty for CacheTTL.
+With the Concurrency of the ContentStore set, the yield is rendered up front
+whether it is cached or not, see ContentStore.Prepare.
+*/
+func cachedYield(name string, key interface{}, renderArgs map[string]interface{}) (template.HTML, error) {
+	content, err := contentForItems(renderArgs)
+	if err != nil {
+		return "", err
+	}
+	cacheKey := FragmentKey(name, key)
+	if html, found := Cache.Get(cacheKey); found {
+		return html, nil
+	}
+
+	html, err := content.Render(name, renderArgs)
+	if err != nil {
+		return "", err
+	}
+	if content.Has(name) {
+		Cache.Set(cacheKey, html, CacheTTL)
+	}
+	return html, nil
+}
+
+// The key in the Cache for a named yield and the cache key it was given.
+func FragmentKey(name string, key interface{}) string {
+	return fmt.Sprintf("yield:%s:%v", name, key)
+}
+
+// Remove a named yield from the Cache, so it is rendered again the next time
+// it is yielded with the cache key.
+func ExpireFragment(name string, key interface{}) {
+	Cache.Delete(FragmentKey(name, key))
+}
+
+/*
+A FragmentCache kept in memory. Expired fragments are removed when they are
+next looked up, and Set removes any others every minute. When MaxFragments is
+above zero, Set keeps the cache to that many fragments by dropping others at
+random, which matters for fragments cached forever. NewMemoryCache sets it to
+DefaultMaxFragments, the zero value is an empty cache ready to use without one.
+*/
+type MemoryCache struct {
+	MaxFragments int
+
+	mu        sync.RWMutex
+	fragments map[string]cachedFragment
+	swept     time.Time
+}
+
+// The MaxFragments of a new MemoryCache.
+var DefaultMaxFragments = 10000
+
+// How often Set removes expired fragments.
+const sweepInterval = time.Minute
+
+type cachedFragment struct {
+	html    template.HTML
+	expires time.Time
+}
+
+func (cf cachedFragment) expired(now time.Time) bool {
+	return !cf.expires.IsZero() && now.After(cf.expires)
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		MaxFragments: DefaultMaxFragments,
+		fragments:    make(map[string]cachedFragment),
+		swept:        time.Now(),
+	}
+}
+
+func (mc *MemoryCache) Get(key string) (template.HTML, bool) {
+	mc.mu.RLock()
+	fragment, found := mc.fragments[key]
+	mc.mu.RUnlock()
+	if !found {
+		return "", false
+	}
+	if now := time.Now(); fragment.expired(now) {
+		mc.mu.Lock()
+		if fragment, found := mc.fragments[key]; found && fragment.expired(now) {
+			delete(mc.fragments, key)
+		}
+		mc.mu.Unlock()
+		return "", false
+	}
+	return fragment.html, true
+}
+
+func (mc *MemoryCache) Set(key string, html template.HTML, ttl time.Duration) {
+	now := time.Now()
+	fragment := cachedFragment{html: html}
+	if ttl > 0 {
+		fragment.expires = now.Add(ttl)
+	}
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	if mc.fragments == nil {
+		mc.fragments = make(map[string]cachedFragment)
+	}
+	if now.Sub(mc.swept) >= sweepInterval {
+		mc.sweep(now)
+	}
+	if _, found := mc.fragments[key]; !found && mc.MaxFragments > 0 {
+		// Map iteration starts at random, so this drops a random fragment.
+		for other := range mc.fragments {
+			if len(mc.fragments) < mc.MaxFragments {
+				break
+			}
+			delete(mc.fragments, other)
+		}
+	}
+	mc.fragments[key] = fragment
+}
+
+// Remove the expired fragments, the lock must be held.
+func (mc *MemoryCache) sweep(now time.Time) {
+	for key, fragment := range mc.fragments {
+		if fragment.expired(now) {
+			delete(mc.fragments, key)
+		}
+	}
+	mc.swept = now
+}
+
+func (mc *MemoryCache) Delete(key string) {
+	mc.mu.Lock()
+	defer mc.mu.Unlock()
+	delete(mc.fragments, key)
+}
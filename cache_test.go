@@ -0,0 +1,160 @@
+package yield
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheSweepsExpired(t *testing.T) {
+	mc := NewMemoryCache()
+	mc.Set("expired", "old", time.Millisecond)
+	mc.Set("forever", "kept", 0)
+	mc.Set("later", "kept", time.Hour)
+	time.Sleep(2 * time.Millisecond)
+
+	// Within the sweep interval, the expired fragment is only hidden.
+	mc.Set("new", "new", time.Hour)
+	if _, found := mc.Get("expired"); found {
+		t.Error("Expected the expired fragment to be hidden")
+	}
+	mc.Set("expired2", "old", time.Millisecond)
+	time.Sleep(2 * time.Millisecond)
+	if len(mc.fragments) != 4 {
+		t.Errorf("Expected the expired fragment to be kept until the sweep, have %d", len(mc.fragments))
+	}
+
+	mc.swept = time.Now().Add(-sweepInterval)
+	mc.Set("new", "newer", time.Hour)
+	if len(mc.fragments) != 3 {
+		t.Errorf("Expected 3 fragments after the sweep, have %d", len(mc.fragments))
+	}
+	for _, key := range []string{"forever", "later", "new"} {
+		if _, found := mc.Get(key); !found {
+			t.Errorf("Expected %s to be kept", key)
+		}
+	}
+}
+
+func TestMemoryCacheMaxFragments(t *testing.T) {
+	mc := NewMemoryCache()
+	mc.MaxFragments = 10
+	for i := 0; i < 100; i++ {
+		mc.Set(fmt.Sprint(i), "fragment", 0)
+		if len(mc.fragments) > mc.MaxFragments {
+			t.Fatalf("Expected at most %d fragments, have %d", mc.MaxFragments, len(mc.fragments))
+		}
+	}
+	if _, found := mc.Get("99"); !found {
+		t.Error("Expected the latest fragment to be kept")
+	}
+
+	// Replacing a fragment doesn't drop another.
+	mc.Set("99", "replaced", 0)
+	if len(mc.fragments) != mc.MaxFragments {
+		t.Errorf("Expected %d fragments, have %d", mc.MaxFragments, len(mc.fragments))
+	}
+
+	mc.MaxFragments = 0
+	for i := 100; i < 200; i++ {
+		mc.Set(fmt.Sprint(i), "fragment", 0)
+	}
+	if len(mc.fragments) != 110 {
+		t.Errorf("Expected no limit, have %d fragments", len(mc.fragments))
+	}
+}
+
+func TestMemoryCacheZeroValue(t *testing.T) {
+	mc := &MemoryCache{MaxFragments: 5}
+	if _, found := mc.Get("sidebar"); found {
+		t.Error("Expected an empty cache")
+	}
+	mc.Set("sidebar", "<p>Sidebar</p>", time.Hour)
+	if html, found := mc.Get("sidebar"); !found || html != "<p>Sidebar</p>" {
+		t.Errorf("Expected the sidebar, got %q", html)
+	}
+	mc.Delete("sidebar")
+	if _, found := mc.Get("sidebar"); found {
+		t.Error("Expected the sidebar to be deleted")
+	}
+}
+
+// Use a fresh Cache for the rest of the test.
+func setupCache(t *testing.T) {
+	oldCache := Cache
+	Cache = NewMemoryCache()
+	t.Cleanup(func() {
+		Cache = oldCache
+	})
+}
+
+func TestCachedYield(t *testing.T) {
+	setupCache(t)
+	layout := parse("application.html", `<aside>{{cached_yield "sidebar" .user .}}</aside>`)
+	render := func(user, sidebar string) string {
+		args := map[string]interface{}{"user": user}
+		if sidebar != "" {
+			Store(args).AppendHTML("sidebar", template.HTML(sidebar))
+		}
+		var b bytes.Buffer
+		if err := Execute(&b, Fragment("view", ""), []Template{layout}, args); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	cases := []struct {
+		name, user, sidebar, expected string
+	}{
+		{"nothing registered", "ann", "", "<aside></aside>"},
+		{"not cached while nothing was registered", "ann", "first", "<aside>first</aside>"},
+		{"cached", "ann", "second", "<aside>first</aside>"},
+		{"cached without the content", "ann", "", "<aside>first</aside>"},
+		{"another key", "bob", "third", "<aside>third</aside>"},
+	}
+	for _, c := range cases {
+		if body := render(c.user, c.sidebar); body != c.expected {
+			t.Errorf("%s: Expected %q, got %q", c.name, c.expected, body)
+		}
+	}
+
+	ExpireFragment("sidebar", "ann")
+	if body := render("ann", "fourth"); body != "<aside>fourth</aside>" {
+		t.Errorf("Expected the expired fragment to be rendered again, got %q", body)
+	}
+}
+
+// Prepare renders cached yields too, as documented, though the cached
+// fragment is what is output.
+func TestCachedYieldPrepared(t *testing.T) {
+	setupCache(t)
+	Cache.Set(FragmentKey("sidebar", "ann"), "cached", 0)
+	renders := 0
+	sidebar := testTemplate{template.Must(template.New("sidebar.html").Funcs(template.FuncMap{
+		"count": func() string {
+			renders++
+			return "rendered"
+		},
+	}).Parse("{{count}}"))}
+	layout := parse("application.html", `<aside>{{cached_yield "sidebar" .user .}}</aside>`)
+
+	for _, concurrency := range []int{0, 1} {
+		renders = 0
+		args := map[string]interface{}{"user": "ann"}
+		content := Store(args)
+		content.Concurrency = concurrency
+		content.Append("sidebar", sidebar)
+		var b bytes.Buffer
+		if err := Execute(&b, Fragment("view", ""), []Template{layout}, args); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != "<aside>cached</aside>" {
+			t.Errorf("Concurrency %d: Expected the cached fragment, got %q", concurrency, b.String())
+		}
+		if renders != concurrency {
+			t.Errorf("Concurrency %d: Expected %d renders of the yield, got %d", concurrency, concurrency, renders)
+		}
+	}
+}
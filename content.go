@@ -0,0 +1,287 @@
+package yield
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path"
+	"strings"
+	"sync"
+)
+
+// The key in the render arguments that the ContentStore for a render is
+// kept under. The yield functions find it there through the dot.
+const ContentKey = "ContentForItems"
+
+// A Template is anything that can be rendered into a yield or used as a
+// layout. revel.Template satisfies it, as do the templates of a Loader.
+type Template interface {
+	Name() string
+	Render(wr io.Writer, arg interface{}) error
+}
+
+/*
+ContentStore holds what has been registered for each named yield. Each name
+holds an ordered list of templates, so content_for adds to anything already
+registered instead of replacing it, and yield renders the whole list in order.
+Raw HTML fragments are stored alongside the templates and are output as is.
+The main yield is stored under the empty name.
+
+Lookup finds the templates named by content_for_block and partial. Dir is the
+directory partials are looked for in first, usually that of the view, and Format
+is the extension partials are given when their name has none, "html" if empty.
+Flush, when set, is called by a streamed layout just before its main yield is
+rendered, see Stream. Concurrency, when above zero, has Execute and Stream
+render the named yields up front with up to that many at once, see Prepare.
+
+The zero value is an empty store ready to use, though content_for_block and
+partial fail without a Lookup. The registered content may be changed and
+rendered concurrently, the other fields should be set before rendering starts.
+*/
+type ContentStore struct {
+	Lookup      func(name string) (Template, error)
+	Dir         string
+	Format      string
+	Flush       func()
+	Concurrency int
+
+	mu      sync.Mutex
+	items   map[string][]Template
+	changes map[string]int
+}
+
+// The ContentStore kept in the render arguments, which is created and stored
+// there if it is missing.
+func Store(args map[string]interface{}) *ContentStore {
+	if content, ok := args[ContentKey].(*ContentStore); ok {
+		return content
+	}
+	content := &ContentStore{}
+	args[ContentKey] = content
+	return content
+}
+
+// Replace anything registered for the name with the template.
+func (cs *ContentStore) Set(name string, tmpl Template) {
+	cs.change(name, func(tmpls []Template) []Template {
+		return []Template{tmpl}
+	})
+}
+
+// Add templates to the end of the list for the name.
+func (cs *ContentStore) Append(name string, tmpls ...Template) {
+	cs.change(name, func(current []Template) []Template {
+		return append(current, tmpls...)
+	})
+}
+
+// Add templates to the start of the list for the name.
+func (cs *ContentStore) Prepend(name string, tmpls ...Template) {
+	cs.change(name, func(current []Template) []Template {
+		return append(append([]Template{}, tmpls...), current...)
+	})
+}
+
+// Replace anything registered for the name with a raw HTML fragment.
+func (cs *ContentStore) SetHTML(name string, html template.HTML) {
+	cs.Set(name, Fragment(name, html))
+}
+
+// Add a raw HTML fragment to the end of the list for the name.
+func (cs *ContentStore) AppendHTML(name string, html template.HTML) {
+	cs.Append(name, Fragment(name, html))
+}
+
+// Add a raw HTML fragment to the start of the list for the name.
+func (cs *ContentStore) PrependHTML(name string, html template.HTML) {
+	cs.Prepend(name, Fragment(name, html))
+}
+
+// Whether anything has been registered for the name.
+func (cs *ContentStore) Has(name string) bool {
+	return len(cs.Templates(name)) > 0
+}
+
+// The templates registered for the name, in the order they will be rendered.
+func (cs *ContentStore) Templates(name string) []Template {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.items[name]
+}
+
+// Render everything registered for the name, in order. Rendering a name with
+// nothing registered is not an error, it just renders nothing.
+func (cs *ContentStore) Render(name string, args map[string]interface{}) (template.HTML, error) {
+	b := GetBuffer()
+	defer PutBuffer(b)
+	for _, tmpl := range cs.Templates(name) {
+		err := tmpl.Render(b, args)
+		if err != nil {
+			return "", wrapRenderError(yieldCall(name), tmpl, err)
+		}
+	}
+	return template.HTML(b.String()), nil
+}
+
+/*
+Prepare renders every named yield concurrently, with at most limit rendering at
+once, or any number when limit is below one, and replaces the templates of each
+with the HTML they rendered. Later yields of the name just output that HTML.
+The main yield is left alone. Each yield renders with its own copy of args,
+so writes to them are not seen by the others or the layout. Rendering stops at
+the first error or panic, which is returned.
+
+Yields that add content_for other names while rendering do so in whatever
+order they finish. A name changed while its templates render is left to be
+rendered when it is yielded.
+
+Prepare cannot tell which yields the layout renders with cached_yield, so it
+renders those as well, even when their fragment is cached. Caching saves no
+work for them, leave Concurrency at zero for pages that rely on cached_yield.
+*/
+func (cs *ContentStore) Prepare(args map[string]interface{}, limit int) error {
+	cs.mu.Lock()
+	pending := make(map[string]int)
+	for name, tmpls := range cs.items {
+		if name != "" && hasTemplates(tmpls) {
+			pending[name] = cs.changes[name]
+		}
+	}
+	cs.mu.Unlock()
+	if limit < 1 {
+		limit = len(pending)
+	}
+
+	var wg sync.WaitGroup
+	var errMu sync.Mutex
+	var firstErr error
+	failed := func() bool {
+		errMu.Lock()
+		defer errMu.Unlock()
+		return firstErr != nil
+	}
+	fail := func(err error) {
+		errMu.Lock()
+		defer errMu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	sem := make(chan struct{}, limit)
+	for name, version := range pending {
+		sem <- struct{}{}
+		if failed() {
+			<-sem
+			break
+		}
+		wg.Add(1)
+		// Each render gets its own copy of the arguments, as template functions
+		// like revel's set write to them.
+		renderArgs := make(map[string]interface{}, len(args))
+		for key, value := range args {
+			renderArgs[key] = value
+		}
+		go func(name string, version int) {
+			defer func() {
+				if r := recover(); r != nil {
+					fail(fmt.Errorf("Yield %s panicked: %v", name, r))
+				}
+				<-sem
+				wg.Done()
+			}()
+			html, err := cs.Render(name, renderArgs)
+			if err != nil {
+				fail(err)
+				return
+			}
+
+			cs.mu.Lock()
+			defer cs.mu.Unlock()
+			if cs.changes[name] == version {
+				cs.items[name] = []Template{Fragment(name, html)}
+			}
+		}(name, version)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// Whether any of the templates need rendering, rather than being fragments.
+func hasTemplates(tmpls []Template) bool {
+	for _, tmpl := range tmpls {
+		if _, ok := tmpl.(fragment); !ok {
+			return true
+		}
+	}
+	return false
+}
+
+func yieldCall(name string) string {
+	if name == "" {
+		return "yield"
+	}
+	return fmt.Sprintf("yield %q", name)
+}
+
+/*
+Find a partial by name. Partials are templates whose file name starts with an
+underscore, so "hotel" is found as "_hotel.html", first in Dir and then at
+the top level. A name with a directory, i.e. "shared/hotel", is found as
+"shared/_hotel.html".
+*/
+func (cs *ContentStore) Partial(name string) (Template, error) {
+	if cs.Lookup == nil {
+		return nil, fmt.Errorf("Partial: No template lookup is available")
+	}
+	dir, file := path.Split(name)
+	if path.Ext(file) == "" {
+		format := cs.Format
+		if format == "" {
+			format = "html"
+		}
+		file += "." + format
+	}
+	file = dir + "_" + file
+
+	if dir == "" && cs.Dir != "" {
+		if tmpl, err := cs.Lookup(path.Join(cs.Dir, file)); err == nil {
+			return tmpl, nil
+		}
+	}
+	return cs.Lookup(file)
+}
+
+// Replace the templates for the name with those returned by fn.
+func (cs *ContentStore) change(name string, fn func([]Template) []Template) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if cs.items == nil {
+		cs.items = make(map[string][]Template)
+		cs.changes = make(map[string]int)
+	}
+	cs.items[name] = fn(cs.items[name])
+	cs.changes[name]++
+}
+
+// A Template that outputs already rendered HTML, ignoring its argument.
+func Fragment(name string, html template.HTML) Template {
+	return fragment{name, string(html)}
+}
+
+type fragment struct {
+	name   string
+	output string
+}
+
+func (f fragment) Name() string {
+	return f.name
+}
+
+func (f fragment) Content() []string {
+	return strings.Split(f.output, "\n")
+}
+
+func (f fragment) Render(wr io.Writer, arg interface{}) error {
+	_, err := io.WriteString(wr, f.output)
+	return err
+}
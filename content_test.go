@@ -0,0 +1,106 @@
+package yield
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"testing"
+)
+
+// A Template over html/template, with the yield Funcs and a set function
+// that writes to the render arguments, like revel's.
+type testTemplate struct {
+	*template.Template
+}
+
+func (t testTemplate) Render(wr io.Writer, arg interface{}) error {
+	return t.Execute(wr, arg)
+}
+
+var testFuncs = template.FuncMap{
+	"set": func(renderArgs map[string]interface{}, key string, value interface{}) template.JS {
+		renderArgs[key] = value
+		return ""
+	},
+}
+
+func parse(name, text string) Template {
+	tmpl := template.New(name).Funcs(Funcs).Funcs(testFuncs)
+	return testTemplate{template.Must(tmpl.Parse(text))}
+}
+
+// A Lookup over a fixed set of templates.
+func lookup(tmpls ...Template) func(string) (Template, error) {
+	return func(name string) (Template, error) {
+		for _, tmpl := range tmpls {
+			if tmpl.Name() == name {
+				return tmpl, nil
+			}
+		}
+		return nil, fmt.Errorf("No template %s", name)
+	}
+}
+
+type panicTemplate struct{}
+
+func (panicTemplate) Name() string {
+	return "panic.html"
+}
+
+func (panicTemplate) Render(wr io.Writer, arg interface{}) error {
+	panic("broken")
+}
+
+// Run with -race, each yield writes to its render arguments.
+func TestPrepareConcurrentYields(t *testing.T) {
+	args := map[string]interface{}{"user": "ann", "list": make([]int, 1000)}
+	content := Store(args)
+	content.Lookup = lookup(parse("_item.html", `{{set . "item" .name}}[{{.item}}]`))
+	content.Concurrency = 5
+	var names []string
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("yield%d", i)
+		names = append(names, fmt.Sprintf(`{{yield %q .}}`, name))
+		content.Append(name, parse(name+".html",
+			fmt.Sprintf(`{{range .list}}{{set $ "n" %d}}{{end}}{{partial "item" . "name" .user}}{{.n}}`, i)))
+	}
+	layout := parse("layout.html", strings.Join(names, "|")+"|{{yield .}}")
+
+	var b bytes.Buffer
+	err := Execute(&b, parse("view.html", "main"), []Template{layout}, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[ann]0|[ann]1|[ann]2|[ann]3|[ann]4|[ann]5|[ann]6|[ann]7|[ann]8|[ann]9|main"
+	if b.String() != expected {
+		t.Errorf("Rendered %q, expected %q", b.String(), expected)
+	}
+	if _, found := args["n"]; found {
+		t.Error("A prepared yield wrote to the render arguments of the layout")
+	}
+}
+
+func TestPrepareReturnsPanics(t *testing.T) {
+	args := map[string]interface{}{}
+	content := Store(args)
+	content.Append("sidebar", panicTemplate{})
+	content.Append("footer", parse("footer.html", "footer"))
+
+	err := content.Prepare(args, 2)
+	if err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Fatalf("Expected the panic as an error, got %v", err)
+	}
+}
+
+func TestPrepareReturnsFirstError(t *testing.T) {
+	args := map[string]interface{}{"missing": nil}
+	content := Store(args)
+	content.Append("sidebar", parse("sidebar.html", "{{.missing.Name}}"))
+
+	err := content.Prepare(args, 1)
+	if err == nil || !strings.Contains(err.Error(), "sidebar.html") {
+		t.Fatalf("Expected the error from sidebar.html, got %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+package yield
+
+import (
+	"mime"
+	"path"
+	"strings"
+)
+
+// Content types for the formats templates are most often written in, used
+// before falling back to the system's MIME types.
+var ContentTypes = map[string]string{
+	".html": "text/html",
+	".htm":  "text/html",
+	".txt":  "text/plain",
+	".xml":  "application/xml",
+	".json": "application/json",
+	".csv":  "text/csv",
+	".ics":  "text/calendar",
+	".js":   "application/javascript",
+	".css":  "text/css",
+}
+
+/*
+ContentType picks the content type for a rendered template from the extension
+of its name, i.e. "Hotels/Show.html" is "text/html; charset=utf-8". Templates
+always render text, so a UTF-8 charset is added when the type does not have
+one, and names with an unknown extension are "text/plain; charset=utf-8".
+*/
+func ContentType(name string) string {
+	ext := strings.ToLower(path.Ext(name))
+	contentType, found := ContentTypes[ext]
+	if !found {
+		contentType = mime.TypeByExtension(ext)
+	}
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+	if !strings.Contains(contentType, "charset=") {
+		contentType += "; charset=utf-8"
+	}
+	return contentType
+}
@@ -0,0 +1,36 @@
+package yield
+
+import (
+	"testing"
+)
+
+func TestContentType(t *testing.T) {
+	cases := []struct {
+		name, contentType string
+	}{
+		{"Hotels/Show.html", "text/html; charset=utf-8"},
+		{"Hotels/Show.htm", "text/html; charset=utf-8"},
+		{"Hotels/Show.txt", "text/plain; charset=utf-8"},
+		{"Hotels/Show.xml", "application/xml; charset=utf-8"},
+		{"Hotels/Show.json", "application/json; charset=utf-8"},
+		{"Hotels/Show.csv", "text/csv; charset=utf-8"},
+		{"Hotels/Show.ics", "text/calendar; charset=utf-8"},
+		{"Hotels/Show.JSON", "application/json; charset=utf-8"},
+		{".csv", "text/csv; charset=utf-8"},
+		{"Hotels/Show.unknown", "text/plain; charset=utf-8"},
+		{"Hotels/Show", "text/plain; charset=utf-8"},
+	}
+	for _, c := range cases {
+		if contentType := ContentType(c.name); contentType != c.contentType {
+			t.Errorf("ContentType(%q): Expected %q, got %q", c.name, c.contentType, contentType)
+		}
+	}
+}
+
+func TestContentTypeKeepsCharset(t *testing.T) {
+	ContentTypes[".sjis"] = "text/plain; charset=shift_jis"
+	defer delete(ContentTypes, ".sjis")
+	if contentType := ContentType("Hotels/Show.sjis"); contentType != "text/plain; charset=shift_jis" {
+		t.Errorf("Expected the charset to be kept, got %q", contentType)
+	}
+}
@@ -13,5 +13,18 @@ that is why you embed yield.Controller not controllers.Controller.
 
 The booking sample from revel was ported to use the basic yield
 mechanism and is available in the samples directory.
+
+This package holds the parts of yield that do not depend on revel, so the
+same layouts and yields can be used from plain net/http handlers with a
+Renderer:
+
+	renderer, err := yield.NewRenderer([]string{"views"}, []string{"layouts"}, nil)
+	...
+	func(w http.ResponseWriter, r *http.Request) {
+		err := renderer.Render(w, "hotels/show.html", "application.html", map[string]interface{}{
+			"hotel": hotel,
+		})
+		...
+	}
 */
 package yield
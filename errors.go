@@ -0,0 +1,138 @@
+package yield
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"regexp"
+	"strconv"
+	"strings"
+	tmplParse "text/template/parse"
+)
+
+// A Frame is one template in the render stack of a RenderError.
+type Frame struct {
+	// How the template was rendered, i.e. `yield "sidebar"` or `partial "hotel"`.
+	// It is empty for the template Execute started with.
+	Call     string
+	Template string
+}
+
+func (f Frame) String() string {
+	if f.Call == "" {
+		return f.Template
+	}
+	return fmt.Sprintf("%s (%s)", f.Call, f.Template)
+}
+
+/*
+A RenderError is returned when a template fails while rendering, with the
+stack of templates that were being rendered when it did, outermost first. For
+a partial that fails within a named yield of a layout, the message reads:
+
+	layouts/application.html > yield "sidebar" (Hotels/sidebar.html) > partial "hotel" (Hotels/_hotel.html): template: ...
+
+Err is the error from the innermost template. Its position and description
+are taken from the fields of an html/template error, or parsed from the message
+of a text/template one. Name is the template that failed, which may be a
+{{define}} block within the innermost template of the stack. Line and Column
+are 0 when the error does not give them, and Context is the action that failed,
+i.e. ".hotel.Name".
+*/
+type RenderError struct {
+	Stack []Frame
+	Err   error
+
+	Name         string
+	Line, Column int
+	Context      string
+	Description  string
+}
+
+func (e *RenderError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Trace(), e.Err)
+}
+
+// The render stack on one line, outermost first.
+func (e *RenderError) Trace() string {
+	frames := make([]string, len(e.Stack))
+	for i, frame := range e.Stack {
+		frames[i] = frame.String()
+	}
+	return strings.Join(frames, " > ")
+}
+
+func (e *RenderError) Unwrap() error {
+	return e.Err
+}
+
+// The name of the innermost template in the stack, the one that failed.
+func (e *RenderError) Template() string {
+	if len(e.Stack) == 0 {
+		return ""
+	}
+	return e.Stack[len(e.Stack)-1].Template
+}
+
+// Add the template, rendered by call, to the stack of the error from
+// rendering it. Errors from templates rendered within it already have a
+// stack, which is kept below the new frame.
+func wrapRenderError(call string, tmpl Template, err error) error {
+	frame := Frame{Call: call, Template: tmpl.Name()}
+	var inner *RenderError
+	if errors.As(err, &inner) {
+		outer := *inner
+		stack := inner.Stack
+		if len(stack) > 0 && stack[0] == (Frame{Template: frame.Template}) {
+			// The template started its own stack, as it does when a streamed
+			// layout yields to it.
+			stack = stack[1:]
+		}
+		outer.Stack = append([]Frame{frame}, stack...)
+		return &outer
+	}
+	renderErr := &RenderError{Stack: []Frame{frame}, Err: err}
+	renderErr.parse()
+	return renderErr
+}
+
+// Matches the messages of text/template errors, which don't have the position
+// as fields, like:
+//
+//	template: Hotels/Show.html:12:7: executing "Hotels/Show.html" at <.hotel.Name>: nil pointer evaluating *models.Hotel.Name
+//	template: Hotels/Show.html:12: function "hotel" not defined
+var templateErrorPattern = regexp.MustCompile(
+	`(?s)^(?:html/)?template: ?([^:\s]+)(?::(\d+))?(?::(\d+))?: (?:executing "[^"]*" at <(.*?)>: )?(.*)$`)
+
+// Fill in the position of the error, from the fields of an html/template
+// error or else the message of a text/template one. Description is the whole
+// message when it isn't from a template.
+func (e *RenderError) parse() {
+	var htmlErr *template.Error
+	if errors.As(e.Err, &htmlErr) {
+		e.Name, e.Line, e.Description = htmlErr.Name, htmlErr.Line, htmlErr.Description
+		if htmlErr.Node != nil {
+			// The location is "name:line:column".
+			var location string
+			location, e.Context = (*tmplParse.Tree)(nil).ErrorContext(htmlErr.Node)
+			parts := strings.Split(location, ":")
+			if len(parts) >= 3 {
+				e.Name = strings.Join(parts[:len(parts)-2], ":")
+				e.Line, _ = strconv.Atoi(parts[len(parts)-2])
+				e.Column, _ = strconv.Atoi(parts[len(parts)-1])
+			}
+		}
+		return
+	}
+
+	e.Description = e.Err.Error()
+	match := templateErrorPattern.FindStringSubmatch(e.Description)
+	if match == nil {
+		return
+	}
+	e.Name = match[1]
+	e.Line, _ = strconv.Atoi(match[2])
+	e.Column, _ = strconv.Atoi(match[3])
+	e.Context = match[4]
+	e.Description = match[5]
+}
@@ -0,0 +1,152 @@
+package yield
+
+import (
+	"errors"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	textTemplate "text/template"
+)
+
+// A Template over text/template, for errors in the text/template form.
+type textTestTemplate struct {
+	*textTemplate.Template
+}
+
+func (t textTestTemplate) Render(wr io.Writer, arg interface{}) error {
+	return t.Execute(wr, arg)
+}
+
+var errorFuncs = map[string]interface{}{
+	"fail": func() (string, error) {
+		return "", errors.New("boom")
+	},
+}
+
+func parseText(name, text string) Template {
+	tmpl := textTemplate.New(name).Funcs(errorFuncs)
+	return textTestTemplate{textTemplate.Must(tmpl.Parse(text))}
+}
+
+func parseHTML(name, text string) Template {
+	tmpl := template.New(name).Funcs(errorFuncs)
+	return testTemplate{template.Must(tmpl.Parse(text))}
+}
+
+type failingTemplate struct{}
+
+func (failingTemplate) Name() string {
+	return "Hotels/Show.html"
+}
+
+func (failingTemplate) Render(wr io.Writer, arg interface{}) error {
+	return errors.New("connection reset")
+}
+
+// The errors text/template and html/template give, parsed into RenderErrors.
+func TestRenderErrorParse(t *testing.T) {
+	cases := []struct {
+		name         string
+		tmpl         Template
+		line, column int
+		context      string
+		description  string
+	}{
+		{"exec error", parseText("Hotels/Show.txt", "a\n {{index .list 5}}"),
+			2, 3, "index .list 5", "error calling index: index out of range: 5"},
+		{"function error", parseText("Hotels/Show.txt", "a\n{{fail}}"),
+			2, 2, "fail", "error calling fail: boom"},
+		{"html function error", parseHTML("Hotels/Show.html", "<p>\n  {{fail}}</p>"),
+			2, 4, "fail", "error calling fail: boom"},
+		{"not defined", parseText("Hotels/Show.txt", "a\n{{template \"footer\"}}"),
+			2, 11, `{{template "footer"}}`, `template "footer" not defined`},
+		{"no such template", parseHTML("Hotels/Show.html", "a\n{{template \"footer.html\"}}"),
+			2, 11, `{{template "footer.html"}}`, `no such template "footer.html"`},
+		{"html error with a colon in the name", parseHTML("admin:Show.html", "a\n{{template \"footer.html\"}}"),
+			2, 11, `{{template "footer.html"}}`, `no such template "footer.html"`},
+		{"no line", parseHTML("Hotels/Show.html", "<a href=\"{{.}}"),
+			0, 0, "", "ends in a non-text context: "},
+	}
+	for _, c := range cases {
+		err := Execute(ioutil.Discard, c.tmpl, nil, map[string]interface{}{"list": []int{1}})
+		var renderErr *RenderError
+		if !errors.As(err, &renderErr) {
+			t.Errorf("%s: Expected a RenderError, got %v", c.name, err)
+			continue
+		}
+		if renderErr.Name != c.tmpl.Name() || renderErr.Template() != c.tmpl.Name() {
+			t.Errorf("%s: Expected %s, got %q in %q", c.name, c.tmpl.Name(), renderErr.Name, renderErr.Template())
+		}
+		if renderErr.Line != c.line || renderErr.Column != c.column {
+			t.Errorf("%s: Expected %d:%d, got %d:%d", c.name, c.line, c.column, renderErr.Line, renderErr.Column)
+		}
+		if renderErr.Context != c.context {
+			t.Errorf("%s: Expected context %q, got %q", c.name, c.context, renderErr.Context)
+		}
+		if !strings.HasPrefix(renderErr.Description, c.description) {
+			t.Errorf("%s: Expected description %q, got %q", c.name, c.description, renderErr.Description)
+		}
+	}
+}
+
+// The error from html/template is kept, with its ErrorCode.
+func TestRenderErrorKeepsHTMLError(t *testing.T) {
+	err := Execute(ioutil.Discard, parseHTML("Hotels/Show.html", `{{template "footer.html"}}`), nil, nil)
+	var htmlErr *template.Error
+	if !errors.As(err, &htmlErr) || htmlErr.ErrorCode != template.ErrNoSuchTemplate {
+		t.Errorf("Expected the html/template error, got %#v", err)
+	}
+}
+
+// Errors that aren't from a template keep their whole message.
+func TestRenderErrorParseOther(t *testing.T) {
+	cases := []struct {
+		name string
+		tmpl Template
+	}{
+		{"incomplete template", testTemplate{template.New("Hotels/Show.html")}},
+		{"not a template error", failingTemplate{}},
+	}
+	for _, c := range cases {
+		err := Execute(ioutil.Discard, c.tmpl, nil, map[string]interface{}{})
+		var renderErr *RenderError
+		if !errors.As(err, &renderErr) {
+			t.Errorf("%s: Expected a RenderError, got %v", c.name, err)
+			continue
+		}
+		if renderErr.Name != "" || renderErr.Line != 0 || renderErr.Description != renderErr.Err.Error() {
+			t.Errorf("%s: Expected only a description, got %q line %d: %q",
+				c.name, renderErr.Name, renderErr.Line, renderErr.Description)
+		}
+		if renderErr.Template() != "Hotels/Show.html" {
+			t.Errorf("%s: Expected the failing template, got %q", c.name, renderErr.Template())
+		}
+	}
+}
+
+// A failure in a partial within a named yield is reported at the partial, with
+// the templates that rendered it.
+func TestRenderErrorStack(t *testing.T) {
+	args := map[string]interface{}{}
+	content := Store(args)
+	content.Lookup = lookup(parse("_hotel.html", "{{.hotel.Name}}"))
+	content.Append("sidebar", parse("Hotels/sidebar.html", `{{partial "hotel" .}}`))
+	layout := parse("layouts/application.html", `{{yield "sidebar" .}}`)
+	args["hotel"] = (*struct{ Name string })(nil)
+
+	err := Execute(ioutil.Discard, Fragment("Hotels/Show.html", ""), []Template{layout}, args)
+	var renderErr *RenderError
+	if !errors.As(err, &renderErr) {
+		t.Fatalf("Expected a RenderError, got %v", err)
+	}
+	trace := `layouts/application.html > yield "sidebar" (Hotels/sidebar.html) > partial "hotel" (_hotel.html)`
+	if renderErr.Trace() != trace {
+		t.Errorf("Expected %q, got %q", trace, renderErr.Trace())
+	}
+	if renderErr.Name != "_hotel.html" || renderErr.Line != 1 || renderErr.Context != ".hotel.Name" {
+		t.Errorf("Expected _hotel.html:1 at .hotel.Name, got %s:%d at %s",
+			renderErr.Name, renderErr.Line, renderErr.Context)
+	}
+}
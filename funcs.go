@@ -0,0 +1,158 @@
+package yield
+
+import (
+	"fmt"
+	"html/template"
+)
+
+/*
+Funcs are the template functions for working with yields. Add them to the
+functions of any template that yields or sets content, the Renderer and the
+revel Controller both do this for you.
+
+	{{yield .}}                       renders the main yield
+	{{yield "sidebar" .}}             renders a named yield
+	{{could_yield "sidebar" .}}       whether a named yield has any content
+	{{cached_yield "sidebar" .user.Id .}}
+	                                  renders a named yield once per cache key, see Cache
+	{{content_for "title" .Name .}}   adds a string or template.HTML to a named yield
+	{{content_for_block "sidebar" "Hotels/sidebar" .}}
+	                                  renders a template and adds the output to a named yield
+
+	{{partial "hotel" . "hotel" .hotel}}
+	                                  renders the partial _hotel.html, see ContentStore.Partial,
+	                                  with the dot plus any locals given as name and value pairs
+	{{render_collection "hotel" .hotels .}}
+	                                  renders _hotel.html once for each item of a slice
+
+prepend_content_for and prepend_content_for_block add to the start of a named
+yield instead of the end. render is another name for partial. Locals may also
+be given as a single map[string]interface{}.
+*/
+var Funcs = template.FuncMap{
+	"could_yield": func(name string, renderArgs map[string]interface{}) bool {
+		if items, found := renderArgs[ContentKey]; found {
+			if content, ok := items.(*ContentStore); ok {
+				return content.Has(name)
+			} else {
+				return false
+			}
+		} else {
+			return false
+		}
+	},
+
+	"yield": func(args ...interface{}) (template.HTML, error) {
+		var renderArgs map[string]interface{}
+		var target string
+
+		switch len(args) {
+		case 1:
+			if r_arg, ok := args[0].(map[string]interface{}); ok {
+				renderArgs = r_arg
+			} else {
+				return "", fmt.Errorf("Must pass dot into yield")
+			}
+		case 2:
+			if t_arg, ok := args[0].(string); ok {
+				target = t_arg
+			} else {
+				return "", fmt.Errorf("Named yields require the name as the first argument")
+			}
+			if r_arg, ok := args[1].(map[string]interface{}); ok {
+				renderArgs = r_arg
+			} else {
+				return "", fmt.Errorf("Named yields require the dot as the second argument")
+			}
+		default:
+			return "", fmt.Errorf("Yield: Argument Length Error")
+		}
+
+		if items, found := renderArgs[ContentKey]; found {
+			if content, ok := items.(*ContentStore); ok {
+				return content.Render(target, renderArgs)
+			} else {
+				return "", fmt.Errorf("Yield: ContentForItems was overwritten")
+			}
+		} else {
+			return "", fmt.Errorf("Yield requires the base RenderArgs")
+		}
+	},
+
+	"cached_yield": cachedYield,
+
+	"partial":           renderPartial,
+	"render":            renderPartial,
+	"render_collection": renderCollection,
+
+	"content_for": func(name string, html interface{}, renderArgs map[string]interface{}) (string, error) {
+		return contentForHTML(name, html, renderArgs, (*ContentStore).AppendHTML)
+	},
+	"prepend_content_for": func(name string, html interface{}, renderArgs map[string]interface{}) (string, error) {
+		return contentForHTML(name, html, renderArgs, (*ContentStore).PrependHTML)
+	},
+	"content_for_block": func(name, templateName string, renderArgs map[string]interface{}) (string, error) {
+		return contentForBlock(name, templateName, renderArgs, (*ContentStore).AppendHTML)
+	},
+	"prepend_content_for_block": func(name, templateName string, renderArgs map[string]interface{}) (string, error) {
+		return contentForBlock(name, templateName, renderArgs, (*ContentStore).PrependHTML)
+	},
+}
+
+func contentForItems(renderArgs map[string]interface{}) (*ContentStore, error) {
+	if items, found := renderArgs[ContentKey]; found {
+		if content, ok := items.(*ContentStore); ok {
+			return content, nil
+		} else {
+			return nil, fmt.Errorf("content_for: ContentForItems was overwritten")
+		}
+	} else {
+		return nil, fmt.Errorf("content_for requires the base RenderArgs")
+	}
+}
+
+// Strings are escaped as HTML unless the Format of the store is for another
+// format, i.e. json, where escaping is left to the json and xml functions.
+// template.HTML values are used as is.
+func contentForHTML(name string, html interface{}, renderArgs map[string]interface{}, add func(*ContentStore, string, template.HTML)) (string, error) {
+	content, err := contentForItems(renderArgs)
+	if err != nil {
+		return "", err
+	}
+	switch h := html.(type) {
+	case template.HTML:
+		add(content, name, h)
+	case string:
+		if content.Format != "" && !isHTML("."+content.Format) {
+			add(content, name, template.HTML(h))
+		} else {
+			add(content, name, template.HTML(template.HTMLEscapeString(h)))
+		}
+	default:
+		return "", fmt.Errorf("content_for: Content must be a string or template.HTML")
+	}
+	return "", nil
+}
+
+// The template is usually one declared with {{define}} in the view.
+func contentForBlock(name, templateName string, renderArgs map[string]interface{}, add func(*ContentStore, string, template.HTML)) (string, error) {
+	content, err := contentForItems(renderArgs)
+	if err != nil {
+		return "", err
+	}
+	if content.Lookup == nil {
+		return "", fmt.Errorf("content_for_block: No template lookup is available")
+	}
+	tmpl, err := content.Lookup(templateName)
+	if err != nil {
+		return "", err
+	}
+	b := GetBuffer()
+	defer PutBuffer(b)
+	err = tmpl.Render(b, renderArgs)
+	if err != nil {
+		return "", wrapRenderError(fmt.Sprintf("content_for_block %q", name), tmpl, err)
+	}
+	add(content, name, template.HTML(b.String()))
+	return "", nil
+}
@@ -0,0 +1,44 @@
+package yield
+
+import (
+	"bytes"
+	"testing"
+	textTemplate "text/template"
+)
+
+func TestContentForEscaping(t *testing.T) {
+	cases := []struct {
+		format, view, layout, expected string
+	}{
+		{"", `{{content_for "title" .name .}}`, `<title>{{yield "title" .}}</title>`,
+			`<title>A&amp;B &lt;Sea&gt;</title>`},
+		{"html", `{{content_for "title" .name .}}`, `<title>{{yield "title" .}}</title>`,
+			`<title>A&amp;B &lt;Sea&gt;</title>`},
+		{"json", `{{content_for "title" (json .name) .}}`, `{"title": {{yield "title" .}}}`,
+			`{"title": "A\u0026B \u003cSea\u003e"}`},
+		{"xml", `{{content_for "title" (xml .name) .}}`, `<title>{{yield "title" .}}</title>`,
+			`<title>A&amp;B &lt;Sea&gt;</title>`},
+		{"txt", `{{content_for "title" .name .}}`, `Title: {{yield "title" .}}`,
+			`Title: A&B <Sea>`},
+	}
+	for _, c := range cases {
+		var view, layout Template
+		if c.format == "" || c.format == "html" {
+			view, layout = parse("view.html", c.view), parse("layout.html", c.layout)
+		} else {
+			text := textTemplate.New("").Funcs(textTemplate.FuncMap(Funcs)).Funcs(TextFuncs)
+			view = textTestTemplate{textTemplate.Must(text.New("view." + c.format).Parse(c.view))}
+			layout = textTestTemplate{textTemplate.Must(text.New("layout." + c.format).Parse(c.layout))}
+		}
+		args := map[string]interface{}{"name": "A&B <Sea>"}
+		Store(args).Format = c.format
+		var b bytes.Buffer
+		if err := Execute(&b, view, []Template{layout}, args); err != nil {
+			t.Errorf("%s: %v", c.format, err)
+			continue
+		}
+		if b.String() != c.expected {
+			t.Errorf("%s: Expected %q, got %q", c.format, c.expected, b.String())
+		}
+	}
+}
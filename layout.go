@@ -0,0 +1,140 @@
+package yield
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+/*
+Execute renders tmpl into wr inside the layouts, which are ordered from the
+innermost outwards. tmpl is rendered first, so that content_for calls within it
+are visible to the layouts, then each layout in turn with the output of the
+template before it as its main yield. Only the outermost layout is rendered
+directly into wr. Without any layouts, tmpl is rendered straight into wr.
+
+The ContentStore in args is used for the yields, one is added if it is missing.
+When its Concurrency is set, the named yields are rendered concurrently once
+tmpl has rendered, before any layout. Errors are returned as a *RenderError.
+*/
+func Execute(wr io.Writer, tmpl Template, layouts []Template, args map[string]interface{}) error {
+	if len(layouts) == 0 {
+		return render(wr, tmpl, args)
+	}
+
+	content := Store(args)
+	for i, layout := range layouts {
+		b := GetBuffer()
+		err := render(b, tmpl, args)
+		if err != nil {
+			PutBuffer(b)
+			return err
+		}
+		content.Set("", Fragment(tmpl.Name(), template.HTML(b.String())))
+		PutBuffer(b)
+		if i == 0 && content.Concurrency > 0 {
+			err = content.Prepare(args, content.Concurrency)
+			if err != nil {
+				return err
+			}
+		}
+		tmpl = layout
+	}
+	return render(wr, tmpl, args)
+}
+
+/*
+Stream is like Execute, except the outermost layout is rendered first, straight
+into wr, and tmpl and the inner layouts are only rendered when it reaches its
+main yield. Before they are, the Flush hook of the ContentStore is called to
+send what the layout has written so far, usually its <head>, so browsers can
+start fetching stylesheets and scripts while the rest of the page renders.
+
+The catch is that content_for calls made by tmpl can only reach the layouts
+after their main yield, before it named yields only have what was added to the
+ContentStore before rendering started.
+*/
+func Stream(wr io.Writer, tmpl Template, layouts []Template, args map[string]interface{}) error {
+	if len(layouts) == 0 {
+		return render(wr, tmpl, args)
+	}
+
+	content := Store(args)
+	if content.Concurrency > 0 {
+		err := content.Prepare(args, content.Concurrency)
+		if err != nil {
+			return err
+		}
+	}
+	outer := layouts[len(layouts)-1]
+	content.Set("", lazyYield{tmpl: tmpl, layouts: layouts[:len(layouts)-1], content: content})
+	return render(wr, outer, args)
+}
+
+// The main yield of a streamed layout, rendering the template within the
+// inner layouts when it is yielded.
+type lazyYield struct {
+	tmpl    Template
+	layouts []Template
+	content *ContentStore
+}
+
+func (l lazyYield) Name() string {
+	return l.tmpl.Name()
+}
+
+func (l lazyYield) Render(wr io.Writer, arg interface{}) error {
+	args, ok := arg.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("Must pass dot into yield")
+	}
+	if l.content.Flush != nil {
+		l.content.Flush()
+	}
+	return Execute(wr, l.tmpl, l.layouts, args)
+}
+
+// Render a template at the bottom of the render stack.
+func render(wr io.Writer, tmpl Template, args map[string]interface{}) error {
+	err := tmpl.Render(wr, args)
+	if err != nil {
+		return wrapRenderError("", tmpl, err)
+	}
+	return nil
+}
+
+/*
+LayoutChain finds the named layout and the layouts it is nested within, ordered
+from the innermost outwards, ready for Execute. parents maps the name of a layout
+to the name of the layout it should be rendered into, with or without the
+extension of the inner layout. It is an error for a layout to be its own ancestor.
+*/
+func LayoutChain(name string, parents map[string]string, find func(name string) (Template, error)) ([]Template, error) {
+	layout, err := find(name)
+	if err != nil {
+		return nil, err
+	}
+	chain := []Template{layout}
+	seen := map[string]bool{layout.Name(): true}
+	for name := parentName(layout.Name(), parents); name != ""; name = parentName(layout.Name(), parents) {
+		layout, err = find(name)
+		if err != nil {
+			return nil, err
+		}
+		if seen[layout.Name()] {
+			return nil, fmt.Errorf("Layout %s is its own ancestor", layout.Name())
+		}
+		seen[layout.Name()] = true
+		chain = append(chain, layout)
+	}
+	return chain, nil
+}
+
+func parentName(name string, parents map[string]string) string {
+	if parent, found := parents[name]; found {
+		return parent
+	}
+	return parents[strings.TrimSuffix(name, filepath.Ext(name))]
+}
@@ -0,0 +1,109 @@
+package yield
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestStreamFlushesBeforeMainYield(t *testing.T) {
+	view := parse("Hotels/Show.html", `{{content_for "footer" "Ritz footer" .}}<h1>Ritz</h1>`)
+	layouts := []Template{
+		parse("admin.html", `<div>{{yield .}}</div>`),
+		parse("application.html", `<title>{{yield "title" .}}</title><main>{{yield .}}</main><footer>{{yield "footer" .}}</footer>`),
+	}
+	args := map[string]interface{}{}
+	content := Store(args)
+	content.AppendHTML("title", "Hotel")
+
+	var b bytes.Buffer
+	var flushed []string
+	content.Flush = func() {
+		flushed = append(flushed, b.String())
+	}
+	if err := Stream(&b, view, layouts, args); err != nil {
+		t.Fatal(err)
+	}
+	expected := `<title>Hotel</title><main><div><h1>Ritz</h1></div></main><footer>Ritz footer</footer>`
+	if b.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, b.String())
+	}
+	if len(flushed) != 1 || flushed[0] != "<title>Hotel</title><main>" {
+		t.Errorf("Expected one flush before the main yield, got %q", flushed)
+	}
+}
+
+// Errors in the view are returned after the head of the layout was written.
+func TestStreamError(t *testing.T) {
+	args := map[string]interface{}{"missing": nil}
+	var b bytes.Buffer
+	err := Stream(&b, parse("Hotels/Show.html", `{{.missing.Name}}`),
+		[]Template{parse("application.html", `<main>{{yield .}}</main>`)}, args)
+	if err == nil {
+		t.Fatal("Expected an error")
+	}
+	if b.String() != "<main>" {
+		t.Errorf("Expected the head of the layout, got %q", b.String())
+	}
+}
+
+var benchLayout = `<html><head><title>{{yield "title" .}}</title>{{yield "head" .}}</head>
+<body><nav>{{yield "nav" .}}</nav><aside>{{yield "sidebar" .}}</aside>
+<main>{{yield .}}</main><footer>{{yield "footer" .}}</footer></body></html>`
+
+/*
+Render a view of 20 hotels into the layouts, with each named yield of
+benchLayout registered and a partial for each hotel in the sidebar. The
+templates are parsed once, the render arguments and their ContentStore are
+made for each render, as they are for each request.
+*/
+func benchmarkExecute(b *testing.B, execute func(io.Writer, Template, []Template, map[string]interface{}) error,
+	concurrency int, layouts ...Template) {
+	hotels := make([]string, 20)
+	for i := range hotels {
+		hotels[i] = fmt.Sprintf("Hotel %d", i)
+	}
+	view := parse("Hotels/Index.html", strings.Repeat(`<p>{{range .hotels}}{{.}} {{end}}</p>`, 5))
+	partials := lookup(parse("_hotel.html", `<li>{{.hotel}}</li>`))
+	head := parse("head.html", `<meta name="description" content="{{len .hotels}} hotels">`)
+	nav := parse("nav.html", `{{range .hotels}}<a href="#">{{.}}</a>{{end}}`)
+	sidebar := parse("sidebar.html", `<ul>{{range .hotels}}{{partial "hotel" $ "hotel" .}}{{end}}</ul>`)
+	footer := parse("footer.html", `<p>{{len .hotels}} hotels</p>`)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		args := map[string]interface{}{"hotels": hotels}
+		content := Store(args)
+		content.Lookup = partials
+		content.Concurrency = concurrency
+		content.AppendHTML("title", "Hotels")
+		content.Append("head", head)
+		content.Append("nav", nav)
+		content.Append("sidebar", sidebar)
+		content.Append("footer", footer)
+		if err := execute(ioutil.Discard, view, layouts, args); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExecute(b *testing.B) {
+	benchmarkExecute(b, Execute, 0, parse("application.html", benchLayout))
+}
+
+func BenchmarkExecuteNested(b *testing.B) {
+	benchmarkExecute(b, Execute, 0, parse("admin.html", `<div class="admin">{{yield .}}</div>`),
+		parse("application.html", benchLayout))
+}
+
+func BenchmarkExecuteConcurrent(b *testing.B) {
+	benchmarkExecute(b, Execute, 4, parse("application.html", benchLayout))
+}
+
+func BenchmarkExecuteStream(b *testing.B) {
+	benchmarkExecute(b, Stream, 0, parse("application.html", benchLayout))
+}
@@ -0,0 +1,184 @@
+package yield
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	textTmpl "text/template"
+)
+
+/*
+Loader loads template files from a list of directories. Templates are named by
+their path relative to the directory they were found in, using forward slashes,
+i.e. "Hotels/Show.html". When a name is found in more than one directory, the
+first directory wins. Directories that do not exist are skipped.
+
+HTML templates, those with an extension in HTMLExtensions, are parsed with
+html/template. Everything else, i.e. JSON or XML, is parsed with text/template
+so it is not escaped as HTML, and also gets TextFuncs for escaping. The HTML
+templates of a Loader are parsed together, as are the others, so they can use
+each other with {{template}}. A Loader is safe for concurrent use, and Load may
+be called again at any time to pick up changes.
+*/
+type Loader struct {
+	Paths []string
+	Funcs template.FuncMap
+
+	mu      sync.RWMutex
+	html    *template.Template
+	text    *textTmpl.Template
+	sources map[string]string
+	err     error
+}
+
+// The extensions of the templates a Loader parses with html/template.
+var HTMLExtensions = []string{".html", ".htm"}
+
+/*
+TextFuncs are added to the functions of templates parsed with text/template,
+for escaping values in the format of the template.
+
+	{{json .title}}   the value as JSON, quotes included for strings
+	{{xml .title}}    the value escaped for XML text or attributes
+*/
+var TextFuncs = textTmpl.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+	"xml": func(v interface{}) (string, error) {
+		var b strings.Builder
+		err := xml.EscapeText(&b, []byte(fmt.Sprint(v)))
+		return b.String(), err
+	},
+}
+
+func NewLoader(paths []string, funcs template.FuncMap) *Loader {
+	return &Loader{Paths: paths, Funcs: funcs}
+}
+
+// Load, or reload, all of the templates. When loading fails, the templates
+// loaded before are kept, but Template will return the error until a Load
+// succeeds.
+func (l *Loader) Load() error {
+	html := template.New("").Funcs(l.Funcs)
+	text := textTmpl.New("").Funcs(textTmpl.FuncMap(l.Funcs)).Funcs(TextFuncs)
+	sources := make(map[string]string)
+	err := l.load(html, text, sources)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.err = err
+	if err == nil {
+		l.html, l.text, l.sources = html, text, sources
+	}
+	return err
+}
+
+func (l *Loader) load(html *template.Template, text *textTmpl.Template, sources map[string]string) error {
+	for _, base := range l.Paths {
+		if _, err := os.Stat(base); os.IsNotExist(err) {
+			continue
+		}
+		err := filepath.Walk(base, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if strings.HasPrefix(info.Name(), ".") {
+				if info.IsDir() && path != base {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if info.IsDir() {
+				return nil
+			}
+
+			name, err := filepath.Rel(base, path)
+			if err != nil {
+				return err
+			}
+			name = filepath.ToSlash(name)
+			if _, found := sources[name]; found {
+				return nil
+			}
+
+			source, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			sources[name] = string(source)
+			if isHTML(name) {
+				_, err = html.New(name).Parse(string(source))
+			} else {
+				_, err = text.New(name).Parse(string(source))
+			}
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Find a template by name.
+func (l *Loader) Template(name string) (Template, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if l.err != nil {
+		return nil, l.err
+	}
+	if l.sources == nil {
+		return nil, fmt.Errorf("Templates have not been loaded")
+	}
+	if isHTML(name) {
+		if tmpl := l.html.Lookup(name); tmpl != nil {
+			return fileTemplate{tmpl, l.sources[name]}, nil
+		}
+	} else if tmpl := l.text.Lookup(name); tmpl != nil {
+		return fileTemplate{tmpl, l.sources[name]}, nil
+	}
+	return nil, fmt.Errorf("Template %s not found", name)
+}
+
+func isHTML(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	for _, htmlExt := range HTMLExtensions {
+		if ext == htmlExt {
+			return true
+		}
+	}
+	return false
+}
+
+// Either an html/template or a text/template.
+type executor interface {
+	Name() string
+	Execute(wr io.Writer, data interface{}) error
+}
+
+type fileTemplate struct {
+	tmpl   executor
+	source string
+}
+
+func (t fileTemplate) Name() string {
+	return t.tmpl.Name()
+}
+
+// The source of the template, one line per item.
+func (t fileTemplate) Content() []string {
+	return strings.Split(t.source, "\n")
+}
+
+func (t fileTemplate) Render(wr io.Writer, arg interface{}) error {
+	return t.tmpl.Execute(wr, arg)
+}
@@ -0,0 +1,144 @@
+package yield
+
+import (
+	"fmt"
+	"html/template"
+	"path"
+	"reflect"
+	"strings"
+)
+
+func renderPartial(name string, renderArgs map[string]interface{}, locals ...interface{}) (template.HTML, error) {
+	content, err := contentForItems(renderArgs)
+	if err != nil {
+		return "", err
+	}
+	tmpl, err := content.Partial(name)
+	if err != nil {
+		return "", err
+	}
+	args, err := mergeLocals(renderArgs, locals)
+	if err != nil {
+		return "", err
+	}
+
+	b := GetBuffer()
+	defer PutBuffer(b)
+	err = tmpl.Render(b, args)
+	if err != nil {
+		return "", wrapRenderError(fmt.Sprintf("partial %q", name), tmpl, err)
+	}
+	return template.HTML(b.String()), nil
+}
+
+// A copy of the render arguments with the locals set over them, leaving the
+// render arguments themselves untouched.
+func mergeLocals(renderArgs map[string]interface{}, locals []interface{}) (map[string]interface{}, error) {
+	args := make(map[string]interface{}, len(renderArgs)+len(locals)/2)
+	for key, value := range renderArgs {
+		args[key] = value
+	}
+
+	if len(locals) == 1 {
+		if m, ok := locals[0].(map[string]interface{}); ok {
+			for key, value := range m {
+				args[key] = value
+			}
+			return args, nil
+		}
+	}
+	if len(locals)%2 != 0 {
+		return nil, fmt.Errorf("Partial: Locals must be given as name and value pairs")
+	}
+	for i := 0; i < len(locals); i += 2 {
+		key, ok := locals[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("Partial: Local names must be strings")
+		}
+		args[key] = locals[i+1]
+	}
+	return args, nil
+}
+
+/*
+Renders a partial once for each item of a slice or array. Each render gets the
+render arguments plus the item, named after the partial, and its position:
+
+	{{render_collection "hotel" .hotels .}}
+
+renders _hotel.html with .hotel set to the item, .hotel_index to its index,
+and .hotel_first and .hotel_last to whether it is the first or last item.
+Options may follow as name and value pairs:
+
+	"as"     the name for the item instead of the partial's name
+	"spacer" a partial rendered between each item
+	"empty"  a partial rendered instead when there are no items
+*/
+func renderCollection(name string, items interface{}, renderArgs map[string]interface{}, options ...string) (template.HTML, error) {
+	content, err := contentForItems(renderArgs)
+	if err != nil {
+		return "", err
+	}
+	if len(options)%2 != 0 {
+		return "", fmt.Errorf("Collection: Options must be given as name and value pairs")
+	}
+	as := strings.TrimSuffix(path.Base(name), path.Ext(name))
+	var spacer, empty string
+	for i := 0; i < len(options); i += 2 {
+		switch options[i] {
+		case "as":
+			as = options[i+1]
+		case "spacer":
+			spacer = options[i+1]
+		case "empty":
+			empty = options[i+1]
+		default:
+			return "", fmt.Errorf("Collection: Unknown option %s", options[i])
+		}
+	}
+
+	list := reflect.ValueOf(items)
+	if list.IsValid() && list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+		return "", fmt.Errorf("Collection: Items must be a slice or array, not %s", list.Type())
+	}
+	if !list.IsValid() || list.Len() == 0 {
+		if empty == "" {
+			return "", nil
+		}
+		return renderPartial(empty, renderArgs)
+	}
+
+	tmpl, err := content.Partial(name)
+	if err != nil {
+		return "", err
+	}
+	var spacerTmpl Template
+	if spacer != "" {
+		spacerTmpl, err = content.Partial(spacer)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	b := GetBuffer()
+	defer PutBuffer(b)
+	for i := 0; i < list.Len(); i++ {
+		if i > 0 && spacerTmpl != nil {
+			err = spacerTmpl.Render(b, renderArgs)
+			if err != nil {
+				return "", wrapRenderError(fmt.Sprintf("render_collection %q spacer", name), spacerTmpl, err)
+			}
+		}
+		args, _ := mergeLocals(renderArgs, []interface{}{
+			as, list.Index(i).Interface(),
+			as + "_index", i,
+			as + "_first", i == 0,
+			as + "_last", i == list.Len()-1,
+		})
+		err = tmpl.Render(b, args)
+		if err != nil {
+			return "", wrapRenderError(fmt.Sprintf("render_collection %q", name), tmpl, err)
+		}
+	}
+	return template.HTML(b.String()), nil
+}
@@ -0,0 +1,54 @@
+package yield
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRenderCollection(t *testing.T) {
+	partials := lookup(
+		parse("_hotel.html", `{{if .hotel_first}}[{{end}}{{.hotel_index}}:{{.hotel}}{{if .hotel_last}}]{{end}}`),
+		parse("_item.html", `({{.stay}})`),
+		parse("_comma.html", `, `),
+		parse("_none.html", `No {{.kind}}`),
+	)
+	cases := []struct {
+		name, call string
+		items      interface{}
+		expected   string
+		err        string
+	}{
+		{"locals", `{{render_collection "hotel" .items .}}`, []string{"Ritz", "Savoy", "Hilton"}, "[0:Ritz1:Savoy2:Hilton]", ""},
+		{"one item", `{{render_collection "hotel" .items .}}`, []string{"Ritz"}, "[0:Ritz]", ""},
+		{"array", `{{render_collection "hotel" .items .}}`, [2]int{4, 5}, "[0:41:5]", ""},
+		{"as", `{{render_collection "item" .items . "as" "stay"}}`, []string{"Ritz", "Savoy"}, "(Ritz)(Savoy)", ""},
+		{"spacer", `{{render_collection "item" .items . "as" "stay" "spacer" "comma"}}`, []string{"Ritz", "Savoy", "Hilton"}, "(Ritz), (Savoy), (Hilton)", ""},
+		{"empty", `{{render_collection "hotel" .items . "empty" "none"}}`, []string{}, "No hotels", ""},
+		{"nil", `{{render_collection "hotel" .items . "empty" "none"}}`, nil, "No hotels", ""},
+		{"empty without fallback", `{{render_collection "hotel" .items .}}`, []string{}, "", ""},
+		{"not a slice", `{{render_collection "hotel" .items .}}`, "Ritz", "", "Items must be a slice or array, not string"},
+		{"unknown option", `{{render_collection "hotel" .items . "with" "x"}}`, []string{"Ritz"}, "", "Unknown option with"},
+		{"odd options", `{{render_collection "hotel" .items . "as"}}`, []string{"Ritz"}, "", "name and value pairs"},
+		{"missing partial", `{{render_collection "motel" .items .}}`, []string{"Ritz"}, "", "No template _motel.html"},
+	}
+	for _, c := range cases {
+		args := map[string]interface{}{"items": c.items, "kind": "hotels"}
+		Store(args).Lookup = partials
+		var b bytes.Buffer
+		err := Execute(&b, parse("Hotels/Index.html", c.call), nil, args)
+		if c.err != "" {
+			if err == nil || !strings.Contains(err.Error(), c.err) {
+				t.Errorf("%s: Expected an error with %q, got %v", c.name, c.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if b.String() != c.expected {
+			t.Errorf("%s: Expected %q, got %q", c.name, c.expected, b.String())
+		}
+	}
+}
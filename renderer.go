@@ -0,0 +1,128 @@
+package yield
+
+import (
+	"html/template"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+/*
+Renderer renders views inside layouts for plain net/http handlers, with the same
+yield, could_yield and content_for functions as the revel Controller. Views and
+layouts are html/template files loaded from directories by a Loader each.
+
+ParentLayout nests layouts the same way as the revel Controller's ParentLayout,
+i.e. r.ParentLayout["admin.html"] = "application.html".
+*/
+type Renderer struct {
+	Views        *Loader
+	Layouts      *Loader
+	ParentLayout map[string]string
+}
+
+// Create a Renderer and load its views and layouts. funcs are added to
+// the yield Funcs, and may override them.
+func NewRenderer(viewPaths, layoutPaths []string, funcs template.FuncMap) (*Renderer, error) {
+	allFuncs := template.FuncMap{}
+	for name, fn := range Funcs {
+		allFuncs[name] = fn
+	}
+	for name, fn := range funcs {
+		allFuncs[name] = fn
+	}
+
+	r := &Renderer{
+		Views:        NewLoader(viewPaths, allFuncs),
+		Layouts:      NewLoader(layoutPaths, allFuncs),
+		ParentLayout: make(map[string]string),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload the views and layouts from disk.
+func (r *Renderer) Reload() error {
+	if err := r.Views.Load(); err != nil {
+		return err
+	}
+	return r.Layouts.Load()
+}
+
+/*
+Render the view inside the layout, and its parents, into w. An empty layout
+renders the view on its own. data may be nil, and may have content already
+added to its ContentStore (see Store). The output is buffered, so nothing is
+written to w when rendering fails, leaving the caller free to write an error.
+The Content-Type is picked from the extension of the view, see ContentType,
+unless it has already been set on w.
+*/
+func (r *Renderer) Render(w http.ResponseWriter, view, layout string, data map[string]interface{}) error {
+	tmpl, layouts, data, err := r.prepare(view, layout, data)
+	if err != nil {
+		return err
+	}
+
+	b := GetBuffer()
+	defer PutBuffer(b)
+	err = Execute(b, tmpl, layouts, data)
+	if err != nil {
+		return err
+	}
+	setContentType(w, view)
+	w.Header().Set("Content-Length", strconv.Itoa(b.Len()))
+	_, err = b.WriteTo(w)
+	return err
+}
+
+/*
+The same as Render, except the layout is streamed to w as it renders, with
+everything before its main yield flushed before the view is rendered, see
+Stream. As the response has been started, the caller can't write an error page
+when rendering fails, only log the error.
+*/
+func (r *Renderer) Stream(w http.ResponseWriter, view, layout string, data map[string]interface{}) error {
+	tmpl, layouts, data, err := r.prepare(view, layout, data)
+	if err != nil {
+		return err
+	}
+
+	if flusher, ok := w.(http.Flusher); ok {
+		Store(data).Flush = flusher.Flush
+	}
+	setContentType(w, view)
+	return Stream(w, tmpl, layouts, data)
+}
+
+// Find the view and layouts, and set up the ContentStore in data for the view.
+func (r *Renderer) prepare(view, layout string, data map[string]interface{}) (Template, []Template, map[string]interface{}, error) {
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	content := Store(data)
+	content.Lookup = r.Views.Template
+	content.Dir = path.Dir(view)
+	content.Format = strings.TrimPrefix(path.Ext(view), ".")
+
+	tmpl, err := r.Views.Template(view)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	var layouts []Template
+	if layout != "" {
+		layouts, err = LayoutChain(layout, r.ParentLayout, r.Layouts.Template)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return tmpl, layouts, data, nil
+}
+
+func setContentType(w http.ResponseWriter, view string) {
+	if w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", ContentType(view))
+	}
+}
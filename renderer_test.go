@@ -0,0 +1,137 @@
+package yield
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Write the files into a fresh directory, returning it.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testRenderer(t *testing.T) *Renderer {
+	views := writeFiles(t, map[string]string{
+		"Hotels/Show.html":   `{{content_for "title" .name .}}<h1>{{.name}}</h1>{{partial "rooms" .}}`,
+		"Hotels/_rooms.html": `<p>{{len .rooms}} rooms</p>`,
+		"Hotels/Show.json":   `{"name": {{json .name}}}`,
+		"Hotels/Broken.html": `{{.missing.Name}}`,
+	})
+	layouts := writeFiles(t, map[string]string{
+		"application.html": `<title>{{yield "title" .}}</title><main>{{yield .}}</main>`,
+		"admin.html":       `<div class="admin">{{yield .}}</div>`,
+		"envelope.json":    `{"data": {{yield .}}}`,
+	})
+	r, err := NewRenderer([]string{views}, []string{layouts}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.ParentLayout["admin.html"] = "application.html"
+	return r
+}
+
+func TestRendererRender(t *testing.T) {
+	r := testRenderer(t)
+	cases := []struct {
+		view, layout, contentType, expected string
+	}{
+		{"Hotels/Show.html", "application.html", "text/html; charset=utf-8",
+			`<title>Ritz</title><main><h1>Ritz</h1><p>2 rooms</p></main>`},
+		{"Hotels/Show.html", "admin.html", "text/html; charset=utf-8",
+			`<title>Ritz</title><main><div class="admin"><h1>Ritz</h1><p>2 rooms</p></div></main>`},
+		{"Hotels/Show.html", "", "text/html; charset=utf-8",
+			`<h1>Ritz</h1><p>2 rooms</p>`},
+		{"Hotels/Show.json", "envelope.json", "application/json; charset=utf-8",
+			`{"data": {"name": "Ritz"}}`},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		data := map[string]interface{}{"name": "Ritz", "rooms": []int{1, 2}}
+		if err := r.Render(w, c.view, c.layout, data); err != nil {
+			t.Errorf("%s in %q: %v", c.view, c.layout, err)
+			continue
+		}
+		if w.Body.String() != c.expected {
+			t.Errorf("%s in %q: Expected %q, got %q", c.view, c.layout, c.expected, w.Body.String())
+		}
+		if contentType := w.Header().Get("Content-Type"); contentType != c.contentType {
+			t.Errorf("%s in %q: Expected %q, got %q", c.view, c.layout, c.contentType, contentType)
+		}
+	}
+}
+
+func TestRendererContentTypeOverride(t *testing.T) {
+	r := testRenderer(t)
+	w := httptest.NewRecorder()
+	w.Header().Set("Content-Type", "application/vnd.api+json")
+	if err := r.Render(w, "Hotels/Show.json", "", map[string]interface{}{"name": "Ritz"}); err != nil {
+		t.Fatal(err)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/vnd.api+json" {
+		t.Errorf("Expected the Content-Type set on w to be kept, got %q", contentType)
+	}
+}
+
+func TestRendererErrorsWriteNothing(t *testing.T) {
+	r := testRenderer(t)
+	cases := []struct {
+		view, layout string
+	}{
+		{"Hotels/Broken.html", "application.html"},
+		{"Hotels/Missing.html", "application.html"},
+		{"Hotels/Show.html", "missing.html"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		data := map[string]interface{}{"name": "Ritz", "rooms": []int{}, "missing": nil}
+		if err := r.Render(w, c.view, c.layout, data); err == nil {
+			t.Errorf("%s in %s: Expected an error", c.view, c.layout)
+		}
+		if w.Body.Len() > 0 || len(w.Header()) > 0 {
+			t.Errorf("%s in %s: Expected nothing written, got %q and %v", c.view, c.layout, w.Body.String(), w.Header())
+		}
+	}
+}
+
+// Records what had been written when it was flushed.
+type flushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed []string
+}
+
+func (f *flushRecorder) Flush() {
+	f.flushed = append(f.flushed, f.Body.String())
+}
+
+func TestRendererStream(t *testing.T) {
+	r := testRenderer(t)
+	w := &flushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	// The view's content_for only reaches the layout after its main yield, the
+	// title has to be set up before rendering starts.
+	data := map[string]interface{}{"name": "Ritz", "rooms": []int{1}}
+	Store(data).AppendHTML("title", "Hotel")
+	if err := r.Stream(w, "Hotels/Show.html", "application.html", data); err != nil {
+		t.Fatal(err)
+	}
+	if expected := `<title>Hotel</title><main><h1>Ritz</h1><p>1 rooms</p></main>`; w.Body.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, w.Body.String())
+	}
+	if len(w.flushed) != 1 || w.flushed[0] != "<title>Hotel</title><main>" {
+		t.Errorf("Expected a flush before the main yield, got %q", w.flushed)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "text/html; charset=utf-8" {
+		t.Errorf("Expected text/html, got %q", contentType)
+	}
+}
@@ -1,10 +1,10 @@
 package controllers
 
 import (
-	"code.google.com/p/go.crypto/bcrypt"
-	"github.com/robfig/revel"
-	"github.com/robfig/revel/samples/booking/app/models"
-	"github.com/robfig/revel/samples/booking/app/routes"
+	"github.com/acsellers/yield/samples/booking/app/models"
+	"github.com/acsellers/yield/samples/booking/app/routes"
+	"github.com/revel/revel"
+	"golang.org/x/crypto/bcrypt"
 )
 
 type Application struct {
@@ -13,16 +13,16 @@ type Application struct {
 
 func (c Application) AddUser() revel.Result {
 	if user := c.connected(); user != nil {
-		c.RenderArgs["user"] = user
+		c.ViewArgs["user"] = user
 	}
 	return nil
 }
 
 func (c Application) connected() *models.User {
-	if c.RenderArgs["user"] != nil {
-		return c.RenderArgs["user"].(*models.User)
+	if c.ViewArgs["user"] != nil {
+		return c.ViewArgs["user"].(*models.User)
 	}
-	if username, ok := c.Session["user"]; ok {
+	if username, ok := c.Session["user"].(string); ok {
 		return c.getUser(username)
 	}
 	return nil
@@ -1,14 +1,16 @@
 package controllers
 
 import (
-	"code.google.com/p/go.crypto/bcrypt"
 	"database/sql"
 	"github.com/acsellers/yield/app/controllers"
-	"github.com/coopernurse/gorp"
+	"github.com/acsellers/yield/samples/booking/app/models"
+	"github.com/go-gorp/gorp/v3"
 	_ "github.com/mattn/go-sqlite3"
-	r "github.com/robfig/revel"
-	"github.com/robfig/revel/modules/db/app"
-	"github.com/robfig/revel/samples/booking/app/models"
+	"github.com/revel/modules/db/app"
+	r "github.com/revel/revel"
+	"golang.org/x/crypto/bcrypt"
+	"log"
+	"os"
 )
 
 var (
@@ -52,7 +54,7 @@ func Init() {
 		"NameOnCard": 50,
 	})
 
-	Dbm.TraceOn("[gorp]", r.INFO)
+	Dbm.TraceOn("[gorp]", log.New(os.Stderr, "INFO  ", log.LstdFlags))
 	Dbm.CreateTables()
 
 	bcryptPassword, _ := bcrypt.GenerateFromPassword(
@@ -1,11 +1,11 @@
 package controllers
 
 import (
-	"code.google.com/p/go.crypto/bcrypt"
 	"fmt"
-	"github.com/robfig/revel"
-	"github.com/robfig/revel/samples/booking/app/models"
-	"github.com/robfig/revel/samples/booking/app/routes"
+	"github.com/acsellers/yield/samples/booking/app/models"
+	"github.com/acsellers/yield/samples/booking/app/routes"
+	"github.com/revel/revel"
+	"golang.org/x/crypto/bcrypt"
 	"strings"
 )
 
@@ -38,7 +38,6 @@ func (c Hotels) Index() revel.Result {
 }
 
 func (c Hotels) List(search string, size, page int) revel.Result {
-	c.Layout("")
 	if page == 0 {
 		page = 1
 	}
@@ -86,8 +85,7 @@ func (c Hotels) Show(id int) revel.Result {
 	if hotel == nil {
 		return c.NotFound("Hotel %d does not exist", id)
 	}
-	title := hotel.Name
-	return c.Render(title, hotel)
+	return c.Render(hotel)
 }
 
 func (c Hotels) Settings() revel.Result {
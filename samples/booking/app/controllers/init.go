@@ -2,7 +2,7 @@ package controllers
 
 import (
 	"github.com/acsellers/yield/app/controllers"
-	"github.com/robfig/revel"
+	"github.com/revel/revel"
 )
 
 func init() {
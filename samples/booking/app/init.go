@@ -1,6 +1,6 @@
 package app
 
-import "github.com/robfig/revel"
+import "github.com/revel/revel"
 
 func init() {
 	// Filters is the default set of global filters.
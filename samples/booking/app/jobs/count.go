@@ -2,10 +2,10 @@ package jobs
 
 import (
 	"fmt"
-	"github.com/robfig/revel"
-	"github.com/robfig/revel/modules/jobs/app/jobs"
-	"github.com/robfig/revel/samples/booking/app/controllers"
-	"github.com/robfig/revel/samples/booking/app/models"
+	"github.com/acsellers/yield/samples/booking/app/controllers"
+	"github.com/acsellers/yield/samples/booking/app/models"
+	"github.com/revel/modules/jobs/app/jobs"
+	"github.com/revel/revel"
 )
 
 // Periodically count the bookings in the database.
@@ -13,7 +13,7 @@ type BookingCounter struct{}
 
 func (c BookingCounter) Run() {
 	bookings, err := controllers.Dbm.Select(models.Booking{},
-			`select * from Booking`)
+		`select * from Booking`)
 	if err != nil {
 		panic(err)
 	}
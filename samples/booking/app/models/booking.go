@@ -2,8 +2,8 @@ package models
 
 import (
 	"fmt"
-	"github.com/coopernurse/gorp"
-	"github.com/robfig/revel"
+	"github.com/go-gorp/gorp/v3"
+	"github.com/revel/revel"
 	"regexp"
 	"time"
 )
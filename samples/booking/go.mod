@@ -0,0 +1,35 @@
+module github.com/acsellers/yield/samples/booking
+
+go 1.17
+
+require (
+	github.com/acsellers/yield v0.0.0
+	github.com/go-gorp/gorp/v3 v3.1.0
+	github.com/mattn/go-sqlite3 v2.0.1+incompatible
+	github.com/revel/modules v1.1.0
+	github.com/revel/revel v1.1.0
+	golang.org/x/crypto v0.14.0
+)
+
+require (
+	github.com/bradfitz/gomemcache v0.0.0-20220106215444-fb4bf637b56d // indirect
+	github.com/fsnotify/fsnotify v1.5.1 // indirect
+	github.com/go-stack/stack v1.8.1 // indirect
+	github.com/gomodule/redigo v1.8.8 // indirect
+	github.com/google/uuid v1.3.0 // indirect
+	github.com/inconshreveable/log15 v0.0.0-20201112154412-8562bdadbbac // indirect
+	github.com/mattn/go-colorable v0.1.13 // indirect
+	github.com/mattn/go-isatty v0.0.16 // indirect
+	github.com/patrickmn/go-cache v2.1.0+incompatible // indirect
+	github.com/revel/config v1.0.0 // indirect
+	github.com/revel/cron v0.21.0 // indirect
+	github.com/revel/log15 v2.11.20+incompatible // indirect
+	github.com/revel/pathtree v0.0.0-20140121041023-41257a1839e9 // indirect
+	github.com/xeonx/timeago v1.0.0-rc4 // indirect
+	golang.org/x/net v0.10.0 // indirect
+	golang.org/x/sys v0.13.0 // indirect
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0 // indirect
+	gopkg.in/stack.v0 v0.0.0-20141108040640-9b43fcefddd0 // indirect
+)
+
+replace github.com/acsellers/yield => ../..
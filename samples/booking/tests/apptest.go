@@ -1,9 +1,9 @@
 package tests
 
-import "github.com/robfig/revel"
+import "github.com/revel/revel/testing"
 
 type ApplicationTest struct {
-	revel.TestSuite
+	testing.TestSuite
 }
 
 func (t *ApplicationTest) Before() {